@@ -0,0 +1,3 @@
+module code.google.com/p/go-inject
+
+go 1.23
@@ -0,0 +1,220 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/multi"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+/*
+	Request-scoped container key for the principal the request being served authenticates as, the
+	value returned by the first Authenticator that recognizes the request's credentials, or nil if
+	the request is not authenticated.
+*/
+type Principal struct{}
+
+// Container key for the set of authenticators, tried in the order they were bound.
+type Authenticators struct{}
+
+// The priority of the middleware bound by RequireAuthentication and RequireAuthorization.
+const AuthenticationPriority = 100
+
+/*
+	Authenticates requests with one kind of credentials, like a bearer token. An authenticator is
+	called inside the request scope.
+*/
+type Authenticator interface {
+	/*
+		Returns the principal the request authenticates as. Returns nil and no error if the request
+		has no credentials of this kind, and an error if its credentials are invalid.
+	*/
+	Authenticate(request *http.Request) (interface{}, error)
+
+	// Returns the WWW-Authenticate challenge for the credentials, like `Basic realm="example"`.
+	Challenge() string
+}
+
+// Returns the set of authenticators.
+func authenticators(injector inject.Injector) inject_multi.SetOf[Authenticator] {
+	return inject_multi.EnsureSetOfBound[Authenticator](injector, Authenticators{})
+}
+
+// Binds an authenticator, which is tried after the authenticators that are already bound.
+func BindAuthenticator(injector inject.Injector, authenticator Authenticator) {
+	authenticators(injector).BindInstance(authenticator)
+}
+
+/*
+	Binds a provider of an authenticator, which is tried after the authenticators that are already
+	bound. The provider is called for each request, so the authenticator can depend on
+	request-scoped values.
+*/
+func BindAuthenticatorProvider(injector inject.Injector, provider func(inject.Context, inject.Container) Authenticator) {
+	authenticators(injector).Bind(provider)
+}
+
+// Binds Principal in RequestScoped.
+func bindPrincipal(injector inject.Injector) {
+	authenticators(injector)
+	injector.BindInScope(Principal{}, func(context inject.Context, container inject.Container) interface{} {
+		request := container.GetInstance(context, Request{}).(*http.Request)
+		all := container.GetTaggedInstance(context, Authenticators{}, inject_multi.Values{}).([]Authenticator)
+		for _, authenticator := range all {
+			principal, err := authenticator.Authenticate(request)
+			if err != nil {
+				log.Printf("Rejected credentials of %s %s: %v", request.Method, request.URL, err)
+				return nil
+			}
+			if principal != nil {
+				return principal
+			}
+		}
+		return nil
+	}, RequestScoped{})
+}
+
+// Responds with 401 Unauthorized, challenging the client for each kind of credentials.
+func unauthorized(injector inject.Injector, writer http.ResponseWriter, request *http.Request) {
+	all := injector.CreateContainer().GetTaggedInstance(request, Authenticators{}, inject_multi.Values{}).([]Authenticator)
+	for _, authenticator := range all {
+		if challenge := authenticator.Challenge(); challenge != "" {
+			writer.Header().Add("WWW-Authenticate", challenge)
+		}
+	}
+	http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+/*
+	Binds middleware that responds with 401 Unauthorized to requests that are not authenticated, for
+	the requests whose path is path or is beneath it, like "/admin" and "/admin/users" for "/admin".
+	See RequireAuthorization.
+*/
+func RequireAuthentication(injector inject.Injector, path string) {
+	RequireAuthorization(injector, path, func(interface{}, *http.Request) bool { return true })
+}
+
+/*
+	Binds middleware that responds with 401 Unauthorized to requests that are not authenticated and
+	with 403 Forbidden to requests whose principal authorize rejects, for the requests whose path is
+	path or is beneath it. The middleware wraps every handler and matches the path of each request,
+	so requests are covered whichever route serves them, including a catch-all "/". The path must
+	be a literal path starting with a slash, without a method, host or wildcards.
+*/
+func RequireAuthorization(injector inject.Injector, path string, authorize func(principal interface{}, request *http.Request) bool) {
+	if !strings.HasPrefix(path, "/") || strings.ContainsAny(path, "{} ") {
+		panic(fmt.Sprintf("Authorization requires a literal path like \"/admin\", not %q.", path))
+	}
+	BindMiddleware(injector, AuthenticationPriority, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if !beneath(request.URL.Path, path) {
+				next.ServeHTTP(writer, request)
+				return
+			}
+			principal := injector.CreateContainer().GetInstance(request, Principal{})
+			if principal == nil {
+				unauthorized(injector, writer, request)
+				return
+			}
+			if !authorize(principal, request) {
+				http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(writer, request)
+		})
+	})
+}
+
+// Whether the request path is path or is beneath it.
+func beneath(requestPath string, path string) bool {
+	if requestPath == path || path == "/" {
+		return true
+	}
+	return strings.HasPrefix(requestPath, strings.TrimSuffix(path, "/")+"/")
+}
+
+type bearerAuthenticator struct {
+	verify func(token string) (interface{}, error)
+}
+
+func (this bearerAuthenticator) Authenticate(request *http.Request) (interface{}, error) {
+	scheme, token, found := strings.Cut(request.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return nil, nil
+	}
+	return this.verify(token)
+}
+
+func (this bearerAuthenticator) Challenge() string {
+	return "Bearer"
+}
+
+// Returns an Authenticator of bearer tokens, which verify returns the principal of.
+func BearerAuthenticator(verify func(token string) (interface{}, error)) Authenticator {
+	return bearerAuthenticator{verify}
+}
+
+type basicAuthenticator struct {
+	realm  string
+	verify func(username string, password string) (interface{}, error)
+}
+
+func (this basicAuthenticator) Authenticate(request *http.Request) (interface{}, error) {
+	username, password, ok := request.BasicAuth()
+	if !ok {
+		return nil, nil
+	}
+	return this.verify(username, password)
+}
+
+func (this basicAuthenticator) Challenge() string {
+	return `Basic realm="` + strings.ReplaceAll(this.realm, `"`, `\"`) + `"`
+}
+
+// Returns an Authenticator of HTTP basic credentials, which verify returns the principal of.
+func BasicAuthenticator(realm string, verify func(username string, password string) (interface{}, error)) Authenticator {
+	return basicAuthenticator{realm, verify}
+}
+
+type clientCertificateAuthenticator struct {
+	verify func(certificate *x509.Certificate) (interface{}, error)
+}
+
+func (this clientCertificateAuthenticator) Authenticate(request *http.Request) (interface{}, error) {
+	if request.TLS == nil || len(request.TLS.VerifiedChains) == 0 {
+		return nil, nil
+	}
+	return this.verify(request.TLS.VerifiedChains[0][0])
+}
+
+func (this clientCertificateAuthenticator) Challenge() string {
+	return ""
+}
+
+/*
+	Returns an Authenticator of TLS client certificates, which verify returns the principal of. Only
+	certificates verified by the server's TLS configuration are passed to verify; see
+	tls.Config.ClientAuth.
+*/
+func ClientCertificateAuthenticator(verify func(certificate *x509.Certificate) (interface{}, error)) Authenticator {
+	return clientCertificateAuthenticator{verify}
+}
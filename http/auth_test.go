@@ -0,0 +1,146 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http_test
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/http"
+	"code.google.com/p/go-inject/http/httptest"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func authInjector() inject.Injector {
+	injector := inject.CreateInjector()
+	inject_http.ConfigureScopes(injector)
+	inject_http.ConfigureInjector(injector)
+	inject_http.BindAuthenticator(injector, inject_http.BearerAuthenticator(func(token string) (interface{}, error) {
+		if token != "alice-token" {
+			return nil, errors.New("unknown token")
+		}
+		return "alice", nil
+	}))
+	inject_http.BindAuthenticator(injector, inject_http.BasicAuthenticator("test", func(username, password string) (interface{}, error) {
+		if password != "secret" {
+			return nil, errors.New("wrong password")
+		}
+		return username, nil
+	}))
+	whoami := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, injector.CreateContainer().GetInstance(r, inject_http.Principal{}))
+	}
+	inject_http.BindHandlerFunc(injector, "/public", whoami)
+	inject_http.BindHandlerFunc(injector, "/account/", whoami)
+	inject_http.BindHandlerFunc(injector, "/admin/", whoami)
+	inject_http.RequireAuthentication(injector, "/account/")
+	inject_http.RequireAuthorization(injector, "/admin/", func(principal interface{}, _ *http.Request) bool {
+		return principal == "root"
+	})
+	return injector
+}
+
+func authorized(target string, authorize func(*http.Request)) *http.Request {
+	request := httptest.NewRequest("GET", "http://localhost"+target, nil)
+	authorize(request)
+	return request
+}
+
+func TestAuthenticatorsBindPrincipal(t *testing.T) {
+	harness := inject_httptest.New(authInjector())
+
+	if body := harness.Get("/public").Body.String(); body != "<nil>" {
+		t.Errorf("Expected no principal, got %q", body)
+	}
+	bearer := authorized("/account/", func(r *http.Request) { r.Header.Set("Authorization", "Bearer alice-token") })
+	if body := harness.Do(bearer).Body.String(); body != "alice" {
+		t.Errorf("Expected alice, got %q", body)
+	}
+	basic := authorized("/account/", func(r *http.Request) { r.SetBasicAuth("bob", "secret") })
+	if body := harness.Do(basic).Body.String(); body != "bob" {
+		t.Errorf("Expected bob, got %q", body)
+	}
+}
+
+func TestRequiredAuthenticationResponds401(t *testing.T) {
+	harness := inject_httptest.New(authInjector())
+
+	response := harness.Get("/account/")
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401, got %d", response.Code)
+	}
+	if challenges := response.Header().Values("WWW-Authenticate"); len(challenges) != 2 || challenges[0] != "Bearer" || challenges[1] != `Basic realm="test"` {
+		t.Errorf("Expected a challenge for each authenticator, got %v", challenges)
+	}
+
+	invalid := authorized("/account/", func(r *http.Request) { r.Header.Set("Authorization", "Bearer stolen") })
+	if response := harness.Do(invalid); response.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for an invalid token, got %d", response.Code)
+	}
+}
+
+func TestRequiredAuthorizationResponds403(t *testing.T) {
+	harness := inject_httptest.New(authInjector())
+
+	alice := authorized("/admin/", func(r *http.Request) { r.Header.Set("Authorization", "Bearer alice-token") })
+	if response := harness.Do(alice); response.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for alice, got %d", response.Code)
+	}
+	root := authorized("/admin/", func(r *http.Request) { r.SetBasicAuth("root", "secret") })
+	if response := harness.Do(root); response.Code != http.StatusOK || response.Body.String() != "root" {
+		t.Errorf("Expected root to be authorized, got %d %q", response.Code, response.Body.String())
+	}
+	if response := harness.Get("/admin/"); response.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without credentials, got %d", response.Code)
+	}
+}
+
+func TestRequiredAuthenticationCoversCatchAllRoutes(t *testing.T) {
+	injector := inject.CreateInjector()
+	inject_http.ConfigureScopes(injector)
+	inject_http.ConfigureInjector(injector)
+	inject_http.BindAuthenticator(injector, inject_http.BearerAuthenticator(func(token string) (interface{}, error) {
+		return "alice", nil
+	}))
+	inject_http.BindHandlerFunc(injector, "/", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, "served")
+	})
+	inject_http.RequireAuthentication(injector, "/admin")
+	harness := inject_httptest.New(injector)
+
+	for _, path := range []string{"/admin", "/admin/", "/admin/users"} {
+		if response := harness.Get(path); response.Code != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for %s served by the catch-all route, got %d", path, response.Code)
+		}
+	}
+	for _, path := range []string{"/", "/administrator"} {
+		if response := harness.Get(path); response.Code != http.StatusOK {
+			t.Errorf("Expected %s not to require authentication, got %d", path, response.Code)
+		}
+	}
+}
+
+func TestRequiringAuthenticationForAPatternPanics(t *testing.T) {
+	injector := inject.CreateInjector()
+	defer func() {
+		recover() // Expected
+	}()
+	inject_http.RequireAuthentication(injector, "/users/{id}")
+	t.Error("Expected a panic when requiring authentication for a wildcard pattern")
+}
@@ -0,0 +1,272 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/multi"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+/*
+	Container key for the *http.Client of an upstream declared with DeclareUpstream, tagged with the
+	upstream's tag. The client is shared by every request.
+*/
+type Client struct{}
+
+/*
+	Request-scoped container key for the *http.Client of an upstream declared with DeclareUpstream,
+	tagged with the upstream's tag. The client sets the headers bound with PropagateHeader from the
+	request being served on every call.
+*/
+type RequestClient struct{}
+
+// Container key for the map of upstreams declared with DeclareUpstream, by tag.
+type Upstreams struct{}
+
+// Container key for the transport middleware wrapping each client.
+type ClientMiddleware struct{}
+
+// Container key for the map of headers set on the calls of each RequestClient to request-scoped keys.
+type PropagatedHeaders struct{}
+
+// The configuration of an upstream declared with DeclareUpstream.
+type UpstreamConfig struct {
+	// The URL that relative request URLs are resolved against, like "https://api.example.com/v1/".
+	BaseURL string
+
+	// The time limit for each call, including any retries. 0 means no limit.
+	Timeout time.Duration
+
+	// Headers set on every request that does not already have them.
+	Header http.Header
+
+	// How failed requests are retried.
+	Retry RetryPolicy
+
+	// The transport that sends the requests, or nil for http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+/*
+	How requests to an upstream are retried. A request is retried if it fails with an error, a 5xx
+	status or 429 Too Many Requests, and its method is idempotent. A request with a body is only
+	retried if its GetBody is set, as it is by http.NewRequest.
+*/
+type RetryPolicy struct {
+	// The most times a request is sent. 0 and 1 send a request once.
+	MaxAttempts int
+
+	// How long to wait before the first retry. The wait doubles before each further retry.
+	Backoff time.Duration
+}
+
+type clientMiddleware struct {
+	priority int
+
+	// The tag of the upstream whose client to wrap, or nil to wrap every client.
+	upstream inject.Tag
+
+	wrap func(http.RoundTripper) http.RoundTripper
+}
+
+// Returns the map of declared upstreams.
+func upstreams(injector inject.Injector) inject_multi.MapOf[inject.Tag, UpstreamConfig] {
+	return inject_multi.EnsureMapOfBound[inject.Tag, UpstreamConfig](injector, Upstreams{})
+}
+
+// Returns the set of transport middleware.
+func clientMiddlewareSet(injector inject.Injector) inject_multi.SetOf[clientMiddleware] {
+	return inject_multi.EnsureSetOfBound[clientMiddleware](injector, ClientMiddleware{})
+}
+
+// Returns the map of propagated headers.
+func propagatedHeaders(injector inject.Injector) inject_multi.MapOf[string, inject.Key] {
+	return inject_multi.EnsureMapOfBound[string, inject.Key](injector, PropagatedHeaders{})
+}
+
+/*
+	Declares an upstream identified by tag, that clients call. Declaring the same tag twice panics,
+	naming both callers.
+
+	Binds the following:
+	  inject_http.Upstreams - a map[inject.Tag]UpstreamConfig of the declared upstreams
+	  inject_http.Client<tag> - the *http.Client calling the upstream
+	  inject_http.RequestClient<tag> - a request-scoped *http.Client propagating headers
+	The injector must be configured with ConfigureScopes first.
+*/
+func DeclareUpstream(injector inject.Injector, tag inject.Tag, config UpstreamConfig) {
+	base, err := url.Parse(config.BaseURL)
+	if err != nil {
+		panic(fmt.Sprintf("Invalid base URL for upstream %v: %v", tag, err))
+	}
+	upstreams(injector).BindInstance(tag, config)
+	clientMiddlewareSet(injector)
+	propagatedHeaders(injector)
+
+	injector.BindTagged(Client{}, tag, managed(func(_ inject.Context, container inject.Container) interface{} {
+		log.Printf("Creating HTTP client for %v", tag)
+		all := container.GetTaggedInstance(nil, ClientMiddleware{}, inject_multi.Values{}).([]clientMiddleware)
+		transport := config.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		transport = wrapClientMiddleware(all, tag, transport)
+		if config.Retry.MaxAttempts > 1 {
+			transport = retryTransport{config.Retry, transport}
+		}
+		return &http.Client{
+			Transport: upstreamTransport{base, config.Header, transport},
+			Timeout:   config.Timeout,
+		}
+	}))
+	injector.BindTaggedInScope(RequestClient{}, tag, func(context inject.Context, container inject.Container) interface{} {
+		client := *container.GetTaggedInstance(context, Client{}, tag).(*http.Client)
+		header := make(http.Header)
+		keys := container.GetTaggedInstance(context, PropagatedHeaders{}, inject_multi.Values{}).(map[string]inject.Key)
+		for name, key := range keys {
+			// The propagated values may share dependencies, so each needs its own container.
+			header.Set(name, fmt.Sprint(injector.CreateContainer().GetInstance(context, key)))
+		}
+		client.Transport = upstreamTransport{nil, header, client.Transport}
+		return &client
+	}, RequestScoped{})
+}
+
+/*
+	Binds transport middleware that wraps the transport of every client. Middleware with a lower
+	priority runs first, so it wraps middleware with a higher priority; middleware with the same
+	priority runs in the order it was bound. Middleware sees every attempt of a retried request.
+*/
+func BindClientMiddleware(injector inject.Injector, priority int, wrap func(http.RoundTripper) http.RoundTripper) {
+	clientMiddlewareSet(injector).BindInstance(clientMiddleware{priority, nil, wrap})
+}
+
+// Binds transport middleware that wraps only the client of the upstream. See BindClientMiddleware.
+func BindClientMiddlewareForUpstream(injector inject.Injector, priority int, upstream inject.Tag, wrap func(http.RoundTripper) http.RoundTripper) {
+	clientMiddlewareSet(injector).BindInstance(clientMiddleware{priority, upstream, wrap})
+}
+
+/*
+	Sets the header on every call made with a RequestClient to the value of the request-scoped key,
+	formatted with fmt.Sprint. For example, PropagateHeader(injector, RequestIDHeader, RequestID{})
+	passes the ID of the request being served on to upstreams. Propagating the same header twice
+	panics, naming both callers.
+*/
+func PropagateHeader(injector inject.Injector, header string, key inject.Key) {
+	propagatedHeaders(injector).BindInstance(http.CanonicalHeaderKey(header), key)
+}
+
+// Wraps the transport of the upstream's client in the matching middleware, in priority order.
+func wrapClientMiddleware(all []clientMiddleware, upstream inject.Tag, transport http.RoundTripper) http.RoundTripper {
+	matching := make([]clientMiddleware, 0, len(all))
+	for _, middleware := range all {
+		if middleware.upstream == nil || middleware.upstream == upstream {
+			matching = append(matching, middleware)
+		}
+	}
+	sort.SliceStable(matching, func(i, j int) bool { return matching[i].priority < matching[j].priority })
+	for i := len(matching) - 1; i >= 0; i-- {
+		transport = matching[i].wrap(transport)
+	}
+	return transport
+}
+
+// Resolves relative request URLs against the base URL, and sets default headers.
+type upstreamTransport struct {
+	base   *url.URL
+	header http.Header
+	next   http.RoundTripper
+}
+
+func (this upstreamTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	request = request.Clone(request.Context())
+	if this.base != nil && request.URL.Host == "" {
+		request.URL = this.base.ResolveReference(request.URL)
+		request.Host = ""
+	}
+	for name, values := range this.header {
+		if _, exists := request.Header[name]; !exists {
+			request.Header[name] = values
+		}
+	}
+	return this.next.RoundTrip(request)
+}
+
+// Retries failed requests. See RetryPolicy.
+type retryTransport struct {
+	policy RetryPolicy
+	next   http.RoundTripper
+}
+
+// Whether requests with the method may be sent more than once.
+func idempotent(method string) bool {
+	switch method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// Whether a request that got the response or error should be retried.
+func retryable(response *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests
+}
+
+func (this retryTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if !idempotent(request.Method) || (request.Body != nil && request.Body != http.NoBody && request.GetBody == nil) {
+		return this.next.RoundTrip(request)
+	}
+	backoff := this.policy.Backoff
+	for attempt := 1; ; attempt++ {
+		response, err := this.next.RoundTrip(request)
+		if attempt >= this.policy.MaxAttempts || !retryable(response, err) || request.Context().Err() != nil {
+			return response, err
+		}
+		if response != nil {
+			io.Copy(io.Discard, response.Body)
+			response.Body.Close()
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-request.Context().Done():
+			timer.Stop()
+			return nil, request.Context().Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+
+		if request.GetBody != nil {
+			body, err := request.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			request = request.Clone(request.Context())
+			request.Body = body
+		}
+	}
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http_test
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/http"
+	"code.google.com/p/go-inject/http/httptest"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type Inventory struct{}
+
+// Starts an upstream server that is closed when the test ends.
+func startUpstream(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	upstream := httptest.NewServer(handler)
+	t.Cleanup(upstream.Close)
+	return upstream
+}
+
+// Responds with the path and the X-Caller and X-Request-Id headers.
+func echo(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintf(w, "%s %s %s", r.URL.Path, r.Header.Get("X-Caller"), r.Header.Get(inject_http.RequestIDHeader))
+}
+
+// Returns the body of the response to a GET of the url with the client.
+func get(t *testing.T, client *http.Client, url string) string {
+	response, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	return string(body)
+}
+
+func TestUpstreamClientResolvesRelativeURLs(t *testing.T) {
+	upstream := startUpstream(t, echo)
+	injector := inject.CreateInjector()
+	inject_http.ConfigureScopes(injector)
+	inject_http.DeclareUpstream(injector, Inventory{}, inject_http.UpstreamConfig{
+		BaseURL: upstream.URL + "/v1/",
+		Header:  http.Header{"X-Caller": {"test"}},
+	})
+	var order []string
+	for _, name := range []string{"second", "first"} {
+		name := name
+		priority := map[string]int{"first": 1, "second": 2}[name]
+		inject_http.BindClientMiddleware(injector, priority, func(next http.RoundTripper) http.RoundTripper {
+			return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				return next.RoundTrip(r)
+			})
+		})
+	}
+
+	client := injector.CreateContainer().GetTaggedInstance(nil, inject_http.Client{}, Inventory{}).(*http.Client)
+	if body := get(t, client, "items"); body != "/v1/items test " {
+		t.Errorf("Expected the path and default header, got %q", body)
+	}
+	if strings.Join(order, ",") != "first,second" {
+		t.Errorf("Expected the middleware to run in priority order, got %v", order)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (this roundTripperFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return this(request)
+}
+
+func TestUpstreamClientRetriesIdempotentRequests(t *testing.T) {
+	calls := 0
+	upstream := startUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	})
+	injector := inject.CreateInjector()
+	inject_http.ConfigureScopes(injector)
+	inject_http.DeclareUpstream(injector, Inventory{}, inject_http.UpstreamConfig{
+		BaseURL: upstream.URL,
+		Timeout: time.Second,
+		Retry:   inject_http.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond},
+	})
+	client := injector.CreateContainer().GetTaggedInstance(nil, inject_http.Client{}, Inventory{}).(*http.Client)
+
+	if body := get(t, client, "/"); body != "ok" || calls != 3 {
+		t.Errorf("Expected ok after 3 calls, got %q after %d", body, calls)
+	}
+
+	calls = 0
+	response, err := client.Post("/", "text/plain", strings.NewReader("order"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusServiceUnavailable || calls != 1 {
+		t.Errorf("Expected a POST to be sent once, got %d after %d calls", response.StatusCode, calls)
+	}
+}
+
+func TestRequestClientPropagatesRequestID(t *testing.T) {
+	upstream := startUpstream(t, echo)
+	injector := inject.CreateInjector()
+	inject_http.ConfigureScopes(injector)
+	inject_http.ConfigureInjector(injector)
+	inject_http.DeclareUpstream(injector, Inventory{}, inject_http.UpstreamConfig{BaseURL: upstream.URL})
+	inject_http.PropagateHeader(injector, inject_http.RequestIDHeader, inject_http.RequestID{})
+	inject_http.BindHandlerFunc(injector, "/", func(w http.ResponseWriter, r *http.Request) {
+		client := injector.CreateContainer().GetTaggedInstance(r, inject_http.RequestClient{}, Inventory{}).(*http.Client)
+		response, err := client.Get("/stock")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		io.Copy(w, response.Body)
+	})
+
+	request := httptest.NewRequest("GET", "http://localhost/", nil)
+	request.Header.Set(inject_http.RequestIDHeader, "abc123")
+	if body := inject_httptest.New(injector).Do(request).Body.String(); body != "/stock  abc123" {
+		t.Errorf("Expected the request ID to be propagated, got %q", body)
+	}
+}
@@ -0,0 +1,203 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http
+
+import (
+	"code.google.com/p/go-inject"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// The JSON and HTML form of a binding. See inject.BindingDescription.
+type debugBinding struct {
+	Key         string `json:"key"`
+	Scope       string `json:"scope,omitempty"`
+	Source      string `json:"source"`
+	ExposedFrom string `json:"exposedFrom,omitempty"`
+	Cached      bool   `json:"cached"`
+}
+
+// The JSON and HTML form of an injector. See inject.InjectorDescription.
+type debugInjector struct {
+	Bindings []debugBinding  `json:"bindings"`
+	Children []debugInjector `json:"children"`
+}
+
+// The JSON and HTML form of the values cached in a scope for a context.
+type debugContext struct {
+	Context string   `json:"context"`
+	Keys    []string `json:"keys"`
+}
+
+// The JSON and HTML form of a scope. See inject.ScopeDescription.
+type debugScope struct {
+	Tag         string         `json:"tag"`
+	Inspectable bool           `json:"inspectable"`
+	Contexts    []debugContext `json:"contexts"`
+}
+
+// The JSON and HTML form of the dependencies of a key.
+type debugDependencies struct {
+	Key          string   `json:"key"`
+	Dependencies []string `json:"dependencies"`
+}
+
+// The JSON and HTML form of an inject.Description.
+type debugDescription struct {
+	Injector     debugInjector       `json:"injector"`
+	Scopes       []debugScope        `json:"scopes"`
+	Dependencies []debugDependencies `json:"dependencies"`
+}
+
+// Returns a readable description of a scope's context, like "GET /path" for a request.
+func formatContext(context inject.Context) string {
+	switch context := context.(type) {
+	case nil:
+		return "(all)"
+	case *http.Request:
+		return fmt.Sprintf("%s %s", context.Method, context.URL)
+	case fmt.Stringer:
+		return context.String()
+	}
+	return fmt.Sprintf("%T %p", context, context)
+}
+
+// Returns nil as "", and other keys and tags formatted with inject.FormatKey.
+func formatOptionalKey(key inject.Key) string {
+	if key == nil {
+		return ""
+	}
+	return inject.FormatKey(key)
+}
+
+func newDebugInjector(description inject.InjectorDescription) debugInjector {
+	result := debugInjector{Bindings: []debugBinding{}, Children: []debugInjector{}}
+	for _, binding := range description.Bindings {
+		result.Bindings = append(result.Bindings, debugBinding{
+			Key:         inject.FormatKey(binding.Key),
+			Scope:       formatOptionalKey(binding.Scope),
+			Source:      binding.Source,
+			ExposedFrom: formatOptionalKey(binding.ExposedFrom),
+			Cached:      binding.Cached,
+		})
+	}
+	for _, child := range description.Children {
+		result.Children = append(result.Children, newDebugInjector(child))
+	}
+	return result
+}
+
+func newDebugDescription(description inject.Description) debugDescription {
+	result := debugDescription{
+		Injector:     newDebugInjector(description.Injector),
+		Scopes:       []debugScope{},
+		Dependencies: []debugDependencies{},
+	}
+	for _, scope := range description.Scopes {
+		debug := debugScope{inject.FormatKey(scope.Tag), scope.Cached != nil, []debugContext{}}
+		for _, cached := range scope.Cached {
+			keys := make([]string, len(cached.Keys))
+			for i, key := range cached.Keys {
+				keys[i] = inject.FormatKey(key)
+			}
+			debug.Contexts = append(debug.Contexts, debugContext{formatContext(cached.Context), keys})
+		}
+		result.Scopes = append(result.Scopes, debug)
+	}
+	// The dependencies are sorted by key, so each key's dependencies are adjacent.
+	for _, dependency := range description.Dependencies {
+		from, to := inject.FormatKey(dependency.From), inject.FormatKey(dependency.To)
+		last := len(result.Dependencies) - 1
+		if last < 0 || result.Dependencies[last].Key != from {
+			result.Dependencies = append(result.Dependencies, debugDependencies{from, nil})
+			last++
+		}
+		result.Dependencies[last].Dependencies = append(result.Dependencies[last].Dependencies, to)
+	}
+	return result
+}
+
+var debugTemplate = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Injector</title></head>
+<body>
+<h1>Injectors</h1>
+{{template "injector" .Injector}}
+<h1>Scopes</h1>
+{{range .Scopes}}
+<h2>{{.Tag}}</h2>
+{{if not .Inspectable}}<p>This scope cannot be inspected.</p>{{end}}
+<ul>
+{{range .Contexts}}<li>{{.Context}}<ul>{{range .Keys}}<li>{{.}}</li>{{end}}</ul></li>
+{{end}}
+</ul>
+{{end}}
+<h1>Dependencies</h1>
+<ul>
+{{range .Dependencies}}<li>{{.Key}}<ul>{{range .Dependencies}}<li>{{.}}</li>{{end}}</ul></li>
+{{end}}
+</ul>
+</body>
+</html>
+{{define "injector"}}
+<table border="1">
+<tr><th>Key</th><th>Scope</th><th>Cached</th><th>Source</th><th>Exposed from</th></tr>
+{{range .Bindings}}<tr><td>{{.Key}}</td><td>{{.Scope}}</td><td>{{if .Cached}}yes{{end}}</td><td>{{.Source}}</td><td>{{.ExposedFrom}}</td></tr>
+{{end}}
+</table>
+{{if .Children}}<ul>{{range .Children}}<li>Child injector{{template "injector" .}}</li>{{end}}</ul>{{end}}
+{{end}}`))
+
+type debugHandler struct {
+	injector inject.Injector
+}
+
+func (this debugHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	description := newDebugDescription(inject.Describe(this.injector))
+	if request.URL.Query().Get("format") == "json" || strings.Contains(request.Header.Get("Accept"), "application/json") {
+		writer.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(description)
+		return
+	}
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	debugTemplate.Execute(writer, description)
+}
+
+/*
+	Returns a handler that describes the injector and its descendants: every binding with its scope
+	and source, which scoped values have been created, the contexts active in each scope with the
+	keys cached in them, and the dependencies between the keys provided since the handler was
+	created, which starts recording them. It responds with HTML, or with JSON if the request has
+	the query parameter format=json or accepts application/json. See inject.Describe.
+
+	The description exposes the internals of the process, so the handler is only served if bound
+	with BindDebugHandler, or explicitly by other means.
+*/
+func DebugHandler(injector inject.Injector) http.Handler {
+	inject.RecordDependencies(injector)
+	return debugHandler{injector}
+}
+
+// Binds the DebugHandler for the injector to the pattern, like "/debug/inject".
+func BindDebugHandler(injector inject.Injector, pattern string) {
+	BindHandler(injector, pattern, DebugHandler(injector))
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http_test
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/http"
+	"code.google.com/p/go-inject/http/httptest"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type Greeter struct{}
+
+func debugInjector() inject.Injector {
+	injector := inject.CreateInjector()
+	inject_http.ConfigureScopes(injector)
+	inject_http.ConfigureInjector(injector)
+	injector.BindInScope(Greeter{}, func(_ inject.Context, _ inject.Container) interface{} {
+		return "hello"
+	}, inject.Singleton{})
+	inject_http.BindDebugHandler(injector, "/debug/inject")
+	return injector
+}
+
+func TestDebugHandlerDescribesBindingsAsJSON(t *testing.T) {
+	injector := debugInjector()
+	injector.CreateContainer().GetInstance(nil, Greeter{})
+
+	response := inject_httptest.New(injector).Get("/debug/inject?format=json")
+	var description struct {
+		Injector struct {
+			Bindings []struct {
+				Key    string
+				Scope  string
+				Source string
+				Cached bool
+			}
+		}
+		Scopes []struct {
+			Tag      string
+			Contexts []struct {
+				Context string
+				Keys    []string
+			}
+		}
+	}
+	if err := json.NewDecoder(response.Body).Decode(&description); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, binding := range description.Injector.Bindings {
+		if strings.Contains(binding.Key, "Greeter") {
+			found = true
+			if !binding.Cached || !strings.Contains(binding.Scope, "Singleton") || !strings.Contains(binding.Source, "debug_test.go") {
+				t.Errorf("Expected an instantiated singleton bound in the test, got %+v", binding)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Expected the Greeter binding, got %+v", description.Injector.Bindings)
+	}
+
+	// The debug request itself is active in the request scope.
+	active := false
+	for _, scope := range description.Scopes {
+		for _, context := range scope.Contexts {
+			if context.Context == "GET /debug/inject?format=json" {
+				active = true
+			}
+		}
+	}
+	if !active {
+		t.Errorf("Expected the request to be active in the request scope, got %+v", description.Scopes)
+	}
+}
+
+func TestDebugHandlerRendersHTML(t *testing.T) {
+	response := inject_httptest.New(debugInjector()).Get("/debug/inject")
+	if contentType := response.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/html") {
+		t.Errorf("Expected HTML, got %s", contentType)
+	}
+	if body := response.Body.String(); !strings.Contains(body, "Greeter") {
+		t.Errorf("Expected the Greeter binding in %s", body)
+	}
+}
+
+func TestDebugHandlerIsNotServedUnlessBound(t *testing.T) {
+	injector := inject.CreateInjector()
+	inject_http.ConfigureScopes(injector)
+	inject_http.ConfigureInjector(injector)
+	if response := inject_httptest.New(injector).Get("/debug/inject"); response.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", response.Code)
+	}
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http
+
+import (
+	"code.google.com/p/go-inject"
+	"net/http"
+	"strings"
+)
+
+/*
+	A group of routes under a path prefix, whose handlers are served by the parent injector's server
+	but may depend on bindings in the group's own child injector. Bindings in the group's injector
+	are visible only to the group's handlers and its nested groups.
+
+	Sibling groups may bind the same key, in any scope: scopes cache the values of each group's
+	bindings separately (see inject.OwnedKey), so a key bound in Singleton scope in two groups holds
+	a value for each group.
+
+	Only BindInjectedHandler looks up the group's bindings itself. Handlers bound with BindRoute,
+	BindRouteFunc, BindHandler and BindHandlerFunc are served as is, so they must create their
+	containers from the group's Injector() to see its bindings.
+*/
+type RouteGroup struct {
+	// The injector the routes are bound in, which serves them.
+	parent inject.Injector
+
+	// The tag of the server declared with DeclareServer, or nil for the default server.
+	server inject.Tag
+
+	// The child injector holding the group's bindings.
+	injector inject.Injector
+
+	prefix string
+}
+
+/*
+	Creates a group of routes under the prefix, like "/admin", with a child injector of injector for
+	the bindings of its handlers. The routes are served by the server of injector.
+*/
+func NewRouteGroup(injector inject.Injector, prefix string) *RouteGroup {
+	return &RouteGroup{injector, nil, injector.CreateChildInjector(), strings.TrimSuffix(prefix, "/")}
+}
+
+// Creates a group of routes under the prefix on the server declared with the tag. See NewRouteGroup.
+func NewServerRouteGroup(injector inject.Injector, server inject.Tag, prefix string) *RouteGroup {
+	return &RouteGroup{injector, server, injector.CreateChildInjector(), strings.TrimSuffix(prefix, "/")}
+}
+
+// Returns the child injector for bindings visible only to the group's handlers.
+func (this *RouteGroup) Injector() inject.Injector {
+	return this.injector
+}
+
+// Returns the path prefix of the group.
+func (this *RouteGroup) Prefix() string {
+	return this.prefix
+}
+
+/*
+	Creates a group nested in this group, under the prefix beneath this group's prefix, with a child
+	injector of this group's injector.
+*/
+func (this *RouteGroup) Group(prefix string) *RouteGroup {
+	return &RouteGroup{this.parent, this.server, this.injector.CreateChildInjector(), this.prefix + strings.TrimSuffix(prefix, "/")}
+}
+
+// Exposes a key bound in the group's injector to its parent injector. See inject.Injector.Expose.
+func (this *RouteGroup) Expose(key inject.Key) {
+	this.injector.Expose(key)
+}
+
+// Returns the route beneath the group's prefix.
+func (this *RouteGroup) mount(route Route) Route {
+	route.Pattern = this.prefix + route.Pattern
+	return route
+}
+
+/*
+	Binds a http.Handler to a route beneath the group's prefix. The route "GET /items/{id}" in the
+	group "/admin" serves "GET /admin/items/{id}". Binding a conflicting route panics, naming both
+	callers. The handler must close over the group's Injector() to look up its bindings.
+*/
+func (this *RouteGroup) BindRoute(route Route, handler http.Handler) {
+	if this.server == nil {
+		BindRoute(this.parent, this.mount(route), handler)
+	} else {
+		BindServerRoute(this.parent, this.server, this.mount(route), handler)
+	}
+}
+
+// Binds a handler func to a route beneath the group's prefix. See BindRoute.
+func (this *RouteGroup) BindRouteFunc(route Route, handlerFunc func(http.ResponseWriter, *http.Request)) {
+	this.BindRoute(route, http.HandlerFunc(handlerFunc))
+}
+
+// Binds a http.Handler to a http.ServeMux pattern beneath the group's prefix. See BindRoute.
+func (this *RouteGroup) BindHandler(pattern string, handler http.Handler) {
+	this.BindRoute(ParseRoute(pattern), handler)
+}
+
+// Binds a handler func to a http.ServeMux pattern beneath the group's prefix. See BindRoute.
+func (this *RouteGroup) BindHandlerFunc(pattern string, handlerFunc func(http.ResponseWriter, *http.Request)) {
+	this.BindRoute(ParseRoute(pattern), http.HandlerFunc(handlerFunc))
+}
+
+/*
+	Binds a function whose parameters are injected from the group's injector to a pattern beneath
+	the group's prefix. See BindInjectedHandler.
+*/
+func (this *RouteGroup) BindInjectedHandler(pattern string, fn interface{}, keys ...inject.Key) {
+	route := this.mount(ParseRoute(pattern))
+	this.BindRoute(ParseRoute(pattern), newInjectedHandler(this.injector, route.String(), fn, keys))
+}
+
+// Binds middleware that wraps only the handlers beneath the group's prefix. See BindMiddleware.
+func (this *RouteGroup) BindMiddleware(priority int, wrap func(http.Handler) http.Handler) {
+	BindMiddlewareForPattern(this.parent, priority, this.prefix+"/", wrap)
+}
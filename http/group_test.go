@@ -0,0 +1,114 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http_test
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/http"
+	"code.google.com/p/go-inject/http/httptest"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+type DataSource struct{}
+
+func TestRouteGroupsHaveIsolatedBindings(t *testing.T) {
+	injector := inject.CreateInjector()
+	inject_http.ConfigureScopes(injector)
+	inject_http.ConfigureInjector(injector)
+	for _, name := range []string{"admin", "shop"} {
+		name := name
+		group := inject_http.NewRouteGroup(injector, "/"+name)
+		group.Injector().BindInScope(DataSource{}, func(_ inject.Context, _ inject.Container) interface{} {
+			return name + " data"
+		}, inject_http.RequestScoped{})
+		group.BindInjectedHandler("GET /source", func(w http.ResponseWriter, source string) {
+			fmt.Fprint(w, source)
+		}, DataSource{})
+	}
+	inject_http.BindHandlerFunc(injector, "/source", func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			recover() // Expected, as DataSource is only bound in the groups.
+			fmt.Fprint(w, "none")
+		}()
+		injector.CreateContainer().GetInstance(r, DataSource{})
+	})
+	harness := inject_httptest.New(injector)
+
+	for target, expected := range map[string]string{
+		"/admin/source": "admin data",
+		"/shop/source":  "shop data",
+		"/source":       "none",
+	} {
+		if body := harness.Get(target).Body.String(); body != expected {
+			t.Errorf("Expected %q from %s, got %q", expected, target, body)
+		}
+	}
+}
+
+func TestRouteGroupsHaveSeparateSingletons(t *testing.T) {
+	injector := inject.CreateInjector()
+	inject_http.ConfigureScopes(injector)
+	inject_http.ConfigureInjector(injector)
+	for _, name := range []string{"admin", "shop"} {
+		name := name
+		group := inject_http.NewRouteGroup(injector, "/"+name)
+		group.Injector().BindInScope(DataSource{}, func(_ inject.Context, _ inject.Container) interface{} {
+			return name + " data"
+		}, inject.Singleton{})
+		group.BindInjectedHandler("GET /source", func(w http.ResponseWriter, source string) {
+			fmt.Fprint(w, source)
+		}, DataSource{})
+	}
+	harness := inject_httptest.New(injector)
+
+	for _, target := range []string{"/admin/source", "/shop/source", "/admin/source"} {
+		expected := target[1:len(target)-len("/source")] + " data"
+		if body := harness.Get(target).Body.String(); body != expected {
+			t.Errorf("Expected %q from %s, got %q", expected, target, body)
+		}
+	}
+}
+
+func TestNestedRouteGroupMiddleware(t *testing.T) {
+	injector := inject.CreateInjector()
+	inject_http.ConfigureScopes(injector)
+	inject_http.ConfigureInjector(injector)
+	api := inject_http.NewRouteGroup(injector, "/api/")
+	v1 := api.Group("/v1")
+	api.BindMiddleware(0, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Api", "true")
+			next.ServeHTTP(w, r)
+		})
+	})
+	v1.BindHandlerFunc("/items", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	})
+	inject_http.BindHandlerFunc(injector, "/items", func(w http.ResponseWriter, r *http.Request) {})
+	harness := inject_httptest.New(injector)
+
+	response := harness.Get("/api/v1/items")
+	if response.Body.String() != "/api/v1/items" || response.Header().Get("X-Api") != "true" {
+		t.Errorf("Expected the nested group's route with the group's middleware, got %q %v",
+			response.Body.String(), response.Header())
+	}
+	if response := harness.Get("/items"); response.Header().Get("X-Api") != "" {
+		t.Error("Expected the group's middleware not to wrap routes outside the group")
+	}
+}
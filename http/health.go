@@ -0,0 +1,246 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/multi"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Value for the http_health_check_timeout flag (default: 5s)
+var healthCheckTimeout *time.Duration = flag.Duration(
+	"http_health_check_timeout",
+	5*time.Second,
+	"how long the health handlers wait for health checks before reporting them as failed")
+
+// Container key for the set of health checks.
+type HealthChecks struct{}
+
+// A check of one aspect of the health of the process, like a connection to a database.
+type HealthCheck interface {
+	// Returns nil if healthy. The check should give up when ctx is done.
+	Check(ctx context.Context) error
+}
+
+// Adapts a function to a HealthCheck.
+type HealthCheckFunc func(ctx context.Context) error
+
+func (this HealthCheckFunc) Check(ctx context.Context) error {
+	return this(ctx)
+}
+
+type healthCheck struct {
+	name  string
+	check HealthCheck
+
+	// Whether the check is part of liveness, rather than only readiness.
+	liveness bool
+}
+
+// Returns the set of health checks.
+func healthChecks(injector inject.Injector) inject_multi.SetOf[healthCheck] {
+	return inject_multi.EnsureSetOfBound[healthCheck](injector, HealthChecks{})
+}
+
+type healthCheckName struct {
+	injector inject.Injector
+	name     string
+}
+
+// Where each health check was bound, by injector and name. See bindHealthCheck.
+var healthCheckSources map[healthCheckName]string = make(map[healthCheckName]string)
+
+// Binds the check, panicking with both sources if a check with the same name is already bound.
+func bindHealthCheck(injector inject.Injector, check healthCheck) {
+	name := healthCheckName{injector, check.name}
+	source := inject_multi.CallerSource()
+	if bound, exists := healthCheckSources[name]; exists {
+		panic(fmt.Sprintf("Health check %q is already bound at %s; duplicate binding at %s.", check.name, bound, source))
+	}
+	healthCheckSources[name] = source
+	healthChecks(injector).BindInstance(check)
+}
+
+/*
+	Binds a check reported by the readiness handler. A process that fails a readiness check is
+	running but should not be sent traffic. Checks are reported by name, so binding a second check
+	with the same name panics, naming both callers.
+*/
+func BindHealthCheck(injector inject.Injector, name string, check HealthCheck) {
+	bindHealthCheck(injector, healthCheck{name, check, false})
+}
+
+/*
+	Binds a check reported by both the liveness and readiness handlers. A process that fails a
+	liveness check should be restarted. See BindHealthCheck.
+*/
+func BindLivenessCheck(injector inject.Injector, name string, check HealthCheck) {
+	bindHealthCheck(injector, healthCheck{name, check, true})
+}
+
+// The injectors whose servers are ready to be sent traffic. See SetReady.
+var ready = struct {
+	sync.Mutex
+	injectors map[inject.Injector]bool
+}{injectors: map[inject.Injector]bool{}}
+
+/*
+	Marks the servers of the injector as ready to be sent traffic, or not, as reported by its
+	ReadinessHandler. Run and RunServers mark the injector ready once its servers have started and
+	not ready once they begin shutting down; servers run otherwise, like with RunServer or in tests,
+	are marked with this.
+*/
+func SetReady(injector inject.Injector, isReady bool) {
+	ready.Lock()
+	defer ready.Unlock()
+	if isReady {
+		ready.injectors[injector] = true
+	} else {
+		delete(ready.injectors, injector)
+	}
+}
+
+// Whether the servers of the injector are ready to be sent traffic. See SetReady.
+func isReady(injector inject.Injector) bool {
+	ready.Lock()
+	defer ready.Unlock()
+	return ready.injectors[injector]
+}
+
+// The JSON status of a health check.
+type checkStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// The JSON body of a health handler's response.
+type healthStatus struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkStatus `json:"checks"`
+}
+
+type healthHandler struct {
+	injector inject.Injector
+	liveness bool
+}
+
+/*
+	Runs the checks concurrently, reporting any that do not finish within the timeout, or before
+	the request is cancelled, as failed.
+*/
+func runHealthChecks(requestCtx context.Context, checks map[string]healthCheck) map[string]checkStatus {
+	type result struct {
+		name string
+		err  error
+	}
+	ctx, cancel := context.WithTimeout(requestCtx, *healthCheckTimeout)
+	defer cancel()
+	results := make(chan result, len(checks))
+	for name, check := range checks {
+		go func(name string, check HealthCheck) {
+			results <- result{name, check.Check(ctx)}
+		}(name, check.check)
+	}
+
+	statuses := make(map[string]checkStatus, len(checks))
+	for range checks {
+		select {
+		case result := <-results:
+			if result.err != nil {
+				statuses[result.name] = checkStatus{"failed", result.err.Error()}
+			} else {
+				statuses[result.name] = checkStatus{Status: "ok"}
+			}
+		case <-ctx.Done():
+			unfinished := checkStatus{"failed", "timed out after " + healthCheckTimeout.String()}
+			if err := requestCtx.Err(); err != nil {
+				unfinished.Error = err.Error()
+			}
+			for name := range checks {
+				if _, finished := statuses[name]; !finished {
+					statuses[name] = unfinished
+				}
+			}
+			return statuses
+		}
+	}
+	return statuses
+}
+
+func (this healthHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	all := this.injector.CreateContainer().GetTaggedInstance(
+		nil,
+		HealthChecks{},
+		inject_multi.Values{},
+	).([]healthCheck)
+	checks := make(map[string]healthCheck, len(all))
+	for _, check := range all {
+		if check.liveness || !this.liveness {
+			checks[check.name] = check
+		}
+	}
+
+	status := healthStatus{"ok", runHealthChecks(request.Context(), checks)}
+	for _, check := range status.Checks {
+		if check.Status != "ok" {
+			status.Status = "failed"
+		}
+	}
+	if !this.liveness && status.Status == "ok" && !isReady(this.injector) {
+		status.Status = "starting"
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	if status.Status != "ok" {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(writer).Encode(status)
+}
+
+/*
+	Returns a handler that runs the liveness checks bound in the injector concurrently, and responds
+	with the JSON status of each check. The status is 200 OK if every check passes and 503 Service
+	Unavailable otherwise. Checks that do not finish within the http_health_check_timeout fail.
+*/
+func LivenessHandler(injector inject.Injector) http.Handler {
+	healthChecks(injector)
+	return healthHandler{injector, true}
+}
+
+/*
+	Returns a handler that runs every health check bound in the injector, as described in
+	LivenessHandler. The process is also not ready while the injector is not marked ready: Run and
+	RunServers mark it ready once its servers have started, and not ready again once they begin
+	shutting down. See SetReady.
+*/
+func ReadinessHandler(injector inject.Injector) http.Handler {
+	healthChecks(injector)
+	return healthHandler{injector, false}
+}
+
+// Binds the LivenessHandler and ReadinessHandler to the patterns, like "/healthz" and "/readyz".
+func BindHealthHandlers(injector inject.Injector, livenessPattern string, readinessPattern string) {
+	BindHandler(injector, livenessPattern, LivenessHandler(injector))
+	BindHandler(injector, readinessPattern, ReadinessHandler(injector))
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http_test
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/http"
+	"code.google.com/p/go-inject/http/httptest"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type health struct {
+	Status string
+	Checks map[string]struct {
+		Status string
+		Error  string
+	}
+}
+
+func decodeHealth(t *testing.T, body io.Reader) health {
+	var status health
+	if err := json.NewDecoder(body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func healthInjector() inject.Injector {
+	injector := inject.CreateInjector()
+	inject_http.ConfigureScopes(injector)
+	inject_http.ConfigureInjector(injector)
+	inject_http.BindHealthHandlers(injector, "/healthz", "/readyz")
+	return injector
+}
+
+func TestHealthHandlersReportEachCheck(t *testing.T) {
+	injector := healthInjector()
+	inject_http.BindLivenessCheck(injector, "memory", inject_http.HealthCheckFunc(func(context.Context) error {
+		return nil
+	}))
+	inject_http.BindHealthCheck(injector, "database", inject_http.HealthCheckFunc(func(context.Context) error {
+		return errors.New("connection refused")
+	}))
+	harness := inject_httptest.New(injector)
+
+	response := harness.Get("/healthz")
+	status := decodeHealth(t, response.Body)
+	if response.Code != http.StatusOK || status.Status != "ok" {
+		t.Errorf("Expected liveness to pass, got %d %+v", response.Code, status)
+	}
+	if _, ok := status.Checks["database"]; ok {
+		t.Error("Expected liveness not to run the readiness check")
+	}
+
+	response = harness.Get("/readyz")
+	status = decodeHealth(t, response.Body)
+	if response.Code != http.StatusServiceUnavailable || status.Status != "failed" {
+		t.Errorf("Expected readiness to fail, got %d %+v", response.Code, status)
+	}
+	if check := status.Checks["database"]; check.Status != "failed" || check.Error != "connection refused" {
+		t.Errorf("Expected the database check to fail, got %+v", check)
+	}
+	if check := status.Checks["memory"]; check.Status != "ok" {
+		t.Errorf("Expected the memory check to pass, got %+v", check)
+	}
+}
+
+func TestHealthCheckTimesOut(t *testing.T) {
+	flag.Set("http_health_check_timeout", "10ms")
+	defer flag.Set("http_health_check_timeout", "5s")
+	injector := healthInjector()
+	inject_http.BindLivenessCheck(injector, "stuck", inject_http.HealthCheckFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(time.Second) // Ignores the deadline
+		return nil
+	}))
+
+	response := inject_httptest.New(injector).Get("/healthz")
+	if check := decodeHealth(t, response.Body).Checks["stuck"]; check.Status != "failed" {
+		t.Errorf("Expected the stuck check to time out, got %+v", check)
+	}
+}
+
+func TestNotReadyUntilServerStarts(t *testing.T) {
+	injector := healthInjector()
+	if response := inject_httptest.New(injector).Get("/readyz"); response.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected readiness to fail before the server starts, got %d", response.Code)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inject_http.BindListener(injector, listener)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- inject_http.Run(ctx, injector)
+	}()
+	response, err := http.Get("http://" + listener.Addr().String() + "/readyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := decodeHealth(t, response.Body)
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || status.Status != "ok" {
+		t.Errorf("Expected readiness to pass once the server starts, got %d %+v", response.StatusCode, status)
+	}
+	cancel()
+	<-done
+}
+
+func TestHealthChecksWithTheSameNamePanic(t *testing.T) {
+	injector := healthInjector()
+	check := inject_http.HealthCheckFunc(func(context.Context) error { return nil })
+	inject_http.BindLivenessCheck(injector, "database", check)
+	defer func() {
+		message := fmt.Sprint(recover())
+		if !strings.Contains(message, `"database"`) || strings.Count(message, "health_test.go") != 2 {
+			t.Errorf("Expected a panic naming the check and both bindings, got %q", message)
+		}
+	}()
+	inject_http.BindHealthCheck(injector, "database", check)
+	t.Error("Expected a panic because the database check is already bound")
+}
+
+func TestHarnessMarksReadiness(t *testing.T) {
+	harness := inject_httptest.New(healthInjector())
+	if response := harness.Get("/readyz"); response.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected readiness to fail before the harness is ready, got %d", response.Code)
+	}
+	harness.SetReady(true)
+	defer harness.SetReady(false)
+	if response := harness.Get("/readyz"); response.Code != http.StatusOK {
+		t.Errorf("Expected readiness to pass once the harness is ready, got %d", response.Code)
+	}
+	if response := inject_httptest.New(healthInjector()).Get("/readyz"); response.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected another injector not to be ready, got %d", response.Code)
+	}
+}
+
+func TestCancelledHealthCheckReportsTheCancellation(t *testing.T) {
+	injector := healthInjector()
+	inject_http.BindLivenessCheck(injector, "stuck", inject_http.HealthCheckFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(time.Second) // Ignores the cancellation
+		return nil
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	response := inject_httptest.New(injector).Do(httptest.NewRequest(http.MethodGet, "/healthz", nil).WithContext(ctx))
+	if check := decodeHealth(t, response.Body).Checks["stuck"]; check.Error != context.Canceled.Error() {
+		t.Errorf("Expected the stuck check to report the cancellation, got %+v", check)
+	}
+}
@@ -19,16 +19,18 @@ package inject_http
 import (
 	"code.google.com/p/go-inject"
 	"code.google.com/p/go-inject/multi"
+	"context"
 	"flag"
-	"fmt"
 	"log"
 	"net/http"
+	"reflect"
+	"sync"
 )
 
 // Value for the http_port flag (default: 80)
 var httpPort *int = flag.Int("http_port", 80, "port on which to start the http listener")
 
-// Container key for the HTTP server itself
+// Container key for the HTTP server itself, a *http.Server.
 type Server struct{}
 
 // Container key for looking up handlers.
@@ -40,56 +42,109 @@ type Func struct{}
 // Container key for the HTTP port for the server.
 type Port struct{}
 
+// Container key for the net.Listener the server accepts connections on.
+type Listener struct{}
+
 // Scope tag for the caching in the context of the *http.Request
 type RequestScoped struct{}
 
-type HandlerMap map[interface{}]interface{}
-type HandlerFuncMap map[string]func(http.ResponseWriter, *http.Request)
+// The values of inject_http.Handlers<inject_multi.Values>, assigning a route to a http.Handler.
+type HandlerMap = map[Route]http.Handler
+
+// The values of inject_http.Handlers<inject_http.Func>, assigning a route to a handler func.
+type HandlerFuncMap = map[Route]func(http.ResponseWriter, *http.Request)
 
-var requestScope = inject.CreateSimpleScopeWithName("HTTP Request")
+var requestScope = inject.CreateSimpleScopeWithName("HTTP Request").(inject.SeedableScope)
+
+func init() {
+	// Report the module that bound a handler, rather than this package, on duplicate paths.
+	inject_multi.SkipSources(reflect.TypeOf(Server{}).PkgPath())
+}
 
 type scopingHandler struct {
 	handler http.Handler
 }
 
+/*
+	Serves the request in the request scope, responding with a 500 if the handler panics. Lookups
+	made with the request describe their failures (see inject.DescribeFailures), so that the
+	response can show the keys that were being provided.
+*/
 func (this scopingHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
-	defer requestScope.Exit(request)
-	requestScope.Enter(request)
+	served := &servedRequest{}
+	request = request.WithContext(inject.DescribeFailures(context.WithValue(request.Context(), servedRequestKey{}, served)))
+	defer requestScope.Exit(served)
+	defer func() {
+		if cause := recover(); cause != nil {
+			if cause == http.ErrAbortHandler {
+				panic(cause)
+			}
+			recovered(writer, request, cause)
+		}
+	}()
+	requestScope.Enter(served)
+	seedRequestScope(writer, request)
 	this.handler.ServeHTTP(writer, request)
 }
 
 func providesHttpServer(_ inject.Context, container inject.Container) interface{} {
-	port := container.GetInstance(nil, Port{}).(int)
+	log.Printf("Creating HTTP server")
+	server := &http.Server{Handler: newServeMux(container, nil)}
+	if certificate, ok := boundCertificate(container); ok {
+		server.TLSConfig = NewTLSConfig(certificate)
+	}
+	return server
+}
 
+// Creates a http.ServeMux serving the routes bound to the server with the tag (nil by default).
+func newServeMux(container inject.Container, server inject.Tag) *http.ServeMux {
 	serveMux := http.NewServeMux()
+	middleware := container.GetTaggedInstance(nil, Middleware{}, inject_multi.Values{}).([]middleware)
+	sessionScope, hasSessions := boundSessions(container)
+	scoped := func(route Route, handler http.Handler) http.Handler {
+		handler = wrapMiddleware(middleware, route, seedingHandler{handler})
+		if hasSessions {
+			handler = sessionHandler{sessionScope, handler}
+		}
+		return scopingHandler{handler}
+	}
 
 	handlers := container.GetTaggedInstance(
 		nil,
-		Handlers{},
+		handlersKey(server),
 		inject_multi.Values{},
-	).(map[interface{}]interface{})
-	for path, handler := range handlers {
-		serveMux.Handle(path.(string), scopingHandler{handler.(http.Handler)})
+	).(HandlerMap)
+	for route, handler := range handlers {
+		serveMux.Handle(route.String(), scoped(route, handler))
 	}
 
 	handlerFuncs := container.GetTaggedInstance(
 		nil,
-		inject.TaggedKey{Handlers{}, Func{}},
+		handlerFuncsKey(server),
 		inject_multi.Values{},
-	).(map[interface{}]interface{})
-	for path, handlerFunc := range handlerFuncs {
-		serveMux.HandleFunc(path.(string),
-			func(w http.ResponseWriter, request *http.Request) {
-				defer requestScope.Exit(request)
-				requestScope.Enter(request)
-				handlerFunc.(func(http.ResponseWriter, *http.Request))(w, request)
-			})
+	).(HandlerFuncMap)
+	for route, handlerFunc := range handlerFuncs {
+		serveMux.Handle(route.String(), scoped(route, http.HandlerFunc(handlerFunc)))
 	}
 
-	log.Printf("Creating HTTP server listening on port %d", port)
-	return http.Server{
-		Addr:    fmt.Sprintf(":%d", port),
-		Handler: serveMux,
+	return serveMux
+}
+
+/*
+	Wraps a provider so that its value is created once per binding. Values like the server and its
+	listener are managed by this package: every lookup returns the same value, so the server that is
+	running is the one that Run shuts down.
+*/
+func managed(provider inject.Provider) inject.Provider {
+	var lock sync.Mutex
+	var value interface{}
+	return func(context inject.Context, container inject.Container) interface{} {
+		lock.Lock()
+		defer lock.Unlock()
+		if value == nil {
+			value = provider(context, container)
+		}
+		return value
 	}
 }
 
@@ -101,36 +156,92 @@ func ConfigureFlags(injector inject.Injector) {
 
 // Binds the following:
 //   RequestScoped scope
+//   inject_http.Request - the *http.Request being served
+//   inject_http.ResponseWriter - the http.ResponseWriter for the request
+//   inject_http.RequestContext - the context.Context of the request
+//   inject_http.Header - the http.Header of the request
+//   inject_http.PathValues - a map[string]string of the wildcards in the matched pattern
+//   inject_http.RequestID - the ID of the request, from its X-Request-Id header if it has one
+//   inject_http.Principal - the principal the request authenticates as, or nil
+// The request keys are bound in RequestScoped. All but RequestID and Principal are seeded for
+// every request, and reseeded with the request and writer the handler is called with. Values are
+// looked up with the *http.Request as the context, which may be a request derived from the one being
+// served with WithContext.
 func ConfigureScopes(injector inject.Injector) {
-	injector.BindScope(requestScope, RequestScoped{})
+	injector.BindScope(recordingScope{servedRequestScope{requestScope}}, RequestScoped{})
+	bindSeededKeys(injector)
+	injector.BindInScope(RequestID{}, providesRequestID, RequestScoped{})
+	bindPrincipal(injector)
 }
 
 // Binds the following:
-//   inject_http.Server{} - the HTTP server itself
+//   inject_http.Server{} - the *http.Server itself
+//   inject_http.Listener{} - the net.Listener the server accepts connections on. This is the
+//     listener bound with BindListener or BindUnixListener, if any, or a TCP listener on Port.
 // Requires these bindings:
-//   inject_http.Handlers - a HandlerMap assigning a path to a http.Handler
-//   inject_http.Handlers<inject_http.Func> - a HanderFuncMap assigning a path to a handler func
+//   inject_http.Handlers - a HandlerMap assigning a route to a http.Handler
+//   inject_http.Handlers<inject_http.Func> - a HandlerFuncMap assigning a route to a handler func
+//   inject_http.Middleware - the middleware bound with BindMiddleware
+//   inject_http.Port - the TCP port, if no listener is bound. 0 listens on an ephemeral port.
+// Requests are served in SessionScoped if it is bound with ConfigureSessions.
+// If a certificate is bound with BindCertificate, BindCertificateFiles or
+// BindReloadingCertificateFiles, the server serves HTTPS.
 func ConfigureInjector(injector inject.Injector) {
-	injector.Bind(Server{}, providesHttpServer)
-	inject_multi.EnsureMapBound(injector, Handlers{})
-	inject_multi.EnsureMapBound(injector, inject.TaggedKey{Handlers{}, Func{}})
+	injector.Bind(Server{}, managed(providesHttpServer))
+	boundListener(injector).BindDefaultInScope(providesListener, inject.Singleton{})
+	certificates(injector)
+	sessions(injector)
+	middlewareSet(injector)
+	handlers(injector, nil)
+	handlerFuncs(injector, nil)
 }
 
-func BindHandler(injector inject.Injector, pattern string, handler http.Handler) {
-	inject_multi.BindMapInstance(
+// Tag on the handler keys of a server declared with DeclareServer.
+type serverTag struct {
+	tag inject.Tag
+}
+
+// Returns the key of the handlers of the server with the tag (nil by default).
+func handlersKey(server inject.Tag) inject.Key {
+	if server == nil {
+		return Handlers{}
+	}
+	return inject.TaggedKey{Key: Handlers{}, Tag: serverTag{server}}
+}
+
+// Returns the key of the handler funcs of the server with the tag (nil by default).
+func handlerFuncsKey(server inject.Tag) inject.Key {
+	if server == nil {
+		return inject.TaggedKey{Key: Handlers{}, Tag: Func{}}
+	}
+	return inject.TaggedKey{Key: inject.TaggedKey{Key: Handlers{}, Tag: Func{}}, Tag: serverTag{server}}
+}
+
+// Returns the map of routes to handlers of the server with the tag (nil by default).
+func handlers(injector inject.Injector, server inject.Tag) inject_multi.MapOf[Route, http.Handler] {
+	return inject_multi.EnsureMapOfBound[Route, http.Handler](injector, handlersKey(server))
+}
+
+// Returns the map of routes to handler funcs of the server with the tag (nil by default).
+func handlerFuncs(injector inject.Injector, server inject.Tag) inject_multi.MapOf[Route, func(http.ResponseWriter, *http.Request)] {
+	return inject_multi.EnsureMapOfBound[Route, func(http.ResponseWriter, *http.Request)](
 		injector,
-		Handlers{},
-		pattern,
-		handler,
+		handlerFuncsKey(server),
 	)
 }
 
+/*
+	Binds a http.Handler to a http.ServeMux pattern, which may include a method and host. Binding a
+	conflicting pattern panics, naming both callers. See BindRoute.
+*/
+func BindHandler(injector inject.Injector, pattern string, handler http.Handler) {
+	BindRoute(injector, ParseRoute(pattern), handler)
+}
+
+/*
+	Binds a handler func to a http.ServeMux pattern, which may include a method and host. Binding a
+	conflicting pattern panics, naming both callers. See BindRouteFunc.
+*/
 func BindHandlerFunc(injector inject.Injector, pattern string, handlerFunc func(http.ResponseWriter, *http.Request)) {
-	inject_multi.BindMapTaggedInstance(
-		injector,
-		Handlers{},
-		Func{},
-		pattern,
-		handlerFunc,
-	)
+	BindRouteFunc(injector, ParseRoute(pattern), handlerFunc)
 }
@@ -0,0 +1,139 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+/*
+	Helpers for testing handlers bound with inject_http.BindHandler and BindHandlerFunc without
+	starting a server on a fixed port. A Harness serves requests with the handler of the server
+	bound in an injector, either in memory or through an httptest.Server, and records which
+	request-scoped keys each request provisioned.
+*/
+package inject_httptest
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/http"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+/*
+	Serves requests with the handler of the server bound to inject_http.Server{}. The injector must
+	be configured with inject_http.ConfigureScopes and inject_http.ConfigureInjector; no listener or
+	port is needed.
+
+	Each request enters and exits the request scope exactly as it does in the real server.
+*/
+type Harness struct {
+	injector inject.Injector
+	handler  http.Handler
+
+	lock        sync.Mutex
+	provisioned []inject.Key
+}
+
+// The response to a request served in memory, along with the request-scoped keys it provisioned.
+type Response struct {
+	*httptest.ResponseRecorder
+
+	// The request-scoped keys provisioned while serving the request, in order.
+	Provisioned []inject.Key
+}
+
+// Creates a Harness that serves requests with the server bound in the injector.
+func New(injector inject.Injector) *Harness {
+	server := injector.CreateContainer().GetInstance(nil, inject_http.Server{}).(*http.Server)
+	return &Harness{injector: injector, handler: server.Handler}
+}
+
+// Creates a Harness that serves requests with the server declared with the tag. See DeclareServer.
+func NewTagged(injector inject.Injector, tag inject.Tag) *Harness {
+	server := injector.CreateContainer().GetTaggedInstance(nil, inject_http.Server{}, tag).(*http.Server)
+	return &Harness{injector: injector, handler: server.Handler}
+}
+
+// Returns a handler that serves requests like the bound server, recording provisioned keys.
+func (this *Harness) Handler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		this.serve(writer, request, nil)
+	})
+}
+
+func (this *Harness) serve(writer http.ResponseWriter, request *http.Request, record func(inject.Key)) {
+	this.handler.ServeHTTP(writer, inject_http.RecordProvisions(request, func(key inject.Key) {
+		this.lock.Lock()
+		this.provisioned = append(this.provisioned, key)
+		this.lock.Unlock()
+		if record != nil {
+			record(key)
+		}
+	}))
+}
+
+// Serves the request in memory, without a network connection.
+func (this *Harness) Do(request *http.Request) *Response {
+	response := &Response{ResponseRecorder: httptest.NewRecorder()}
+	this.serve(response.ResponseRecorder, request, func(key inject.Key) {
+		response.Provisioned = append(response.Provisioned, key)
+	})
+	return response
+}
+
+// Serves a GET request for target in memory. See httptest.NewRequest.
+func (this *Harness) Get(target string) *Response {
+	return this.Do(httptest.NewRequest(http.MethodGet, target, nil))
+}
+
+/*
+	Starts an httptest.Server on a loopback address that serves requests like the bound server.
+	The caller should Close it when finished.
+*/
+func (this *Harness) NewServer() *httptest.Server {
+	return httptest.NewServer(this.Handler())
+}
+
+/*
+	Marks the injector ready to be sent traffic, or not, as the ReadinessHandler reports it. The
+	harness does not start a server, so the injector is not ready until this is called. See
+	inject_http.SetReady.
+*/
+func (this *Harness) SetReady(ready bool) {
+	inject_http.SetReady(this.injector, ready)
+}
+
+// Returns the request-scoped keys provisioned by every request served so far, in order.
+func (this *Harness) Provisioned() []inject.Key {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return append([]inject.Key(nil), this.provisioned...)
+}
+
+// Returns whether any request served so far provisioned key in the request scope.
+func (this *Harness) WasProvisioned(key inject.Key) bool {
+	for _, provisioned := range this.Provisioned() {
+		if provisioned == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Forgets the keys provisioned by the requests served so far.
+func (this *Harness) Reset() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.provisioned = nil
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_httptest
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/http"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+)
+
+type Greeting struct{}
+type Unused struct{}
+
+func configure() inject.Injector {
+	injector := inject.CreateInjector()
+	inject_http.ConfigureScopes(injector)
+	inject_http.ConfigureInjector(injector)
+	i := 0
+	injector.BindInScope(Greeting{}, func(_ inject.Context, _ inject.Container) interface{} {
+		i += 1
+		return fmt.Sprintf("Hello, %d!", i)
+	}, inject_http.RequestScoped{})
+	injector.BindInScope(Unused{}, func(_ inject.Context, _ inject.Container) interface{} {
+		return "unused"
+	}, inject_http.RequestScoped{})
+	inject_http.BindHandlerFunc(injector, "/", func(w http.ResponseWriter, request *http.Request) {
+		// Both lookups are served from the request scope.
+		w.Write([]byte(injector.CreateContainer().GetInstance(request, Greeting{}).(string)))
+		w.Write([]byte(injector.CreateContainer().GetInstance(request, Greeting{}).(string)))
+	})
+	return injector
+}
+
+func TestDoServesInMemory(t *testing.T) {
+	harness := New(configure())
+	for i := 1; i <= 2; i++ {
+		response := harness.Get("/")
+		expected := fmt.Sprintf("Hello, %d!Hello, %d!", i, i)
+		if body := response.Body.String(); body != expected {
+			t.Errorf("Expected %q, got %q", expected, body)
+		}
+		if len(response.Provisioned) != 1 || response.Provisioned[0] != (Greeting{}) {
+			t.Errorf("Expected only Greeting to be provisioned, got %v", response.Provisioned)
+		}
+	}
+	if !harness.WasProvisioned(Greeting{}) || harness.WasProvisioned(Unused{}) {
+		t.Errorf("Expected only Greeting to be provisioned, got %v", harness.Provisioned())
+	}
+	harness.Reset()
+	if len(harness.Provisioned()) != 0 {
+		t.Errorf("Expected no provisioned keys after Reset, got %v", harness.Provisioned())
+	}
+}
+
+func TestNewServerServesOverLoopback(t *testing.T) {
+	harness := New(configure())
+	server := harness.NewServer()
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	if string(body) != "Hello, 1!Hello, 1!" {
+		t.Errorf("Expected the request-scoped greeting twice, got %q", body)
+	}
+	if !harness.WasProvisioned(Greeting{}) {
+		t.Errorf("Expected Greeting to be provisioned, got %v", harness.Provisioned())
+	}
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http
+
+import (
+	"code.google.com/p/go-inject"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+)
+
+var (
+	responseWriterType = reflect.TypeOf((*http.ResponseWriter)(nil)).Elem()
+	requestType        = reflect.TypeOf((*http.Request)(nil))
+)
+
+// A handler that calls a function with its parameters resolved from the injector.
+type injectedHandler struct {
+	injector inject.Injector
+	pattern  string
+	fn       reflect.Value
+
+	// The key for each parameter of fn, or nil for the http.ResponseWriter and *http.Request.
+	keys []inject.Key
+}
+
+/*
+	Binds a function to a path as a handler whose parameters are injected. Parameters of type
+	http.ResponseWriter and *http.Request receive the response writer and request being served. Each
+	other parameter is looked up by the corresponding key in keys or, if no keys are given, by its
+	reflect.Type. The function must not return anything.
+
+	The parameters are resolved from a fresh Container inside the request scope on every request,
+	with the *http.Request as the context. If a parameter cannot be resolved, the request fails with
+	a 500 and the chain of keys that failed to resolve is logged.
+*/
+func BindInjectedHandler(injector inject.Injector, pattern string, fn interface{}, keys ...inject.Key) {
+	BindHandler(injector, pattern, newInjectedHandler(injector, pattern, fn, keys))
+}
+
+func newInjectedHandler(injector inject.Injector, pattern string, fn interface{}, keys []inject.Key) injectedHandler {
+	fnValue := reflect.ValueOf(fn)
+	fnType := fnValue.Type()
+	if fnType.Kind() != reflect.Func || fnType.NumOut() != 0 {
+		panic(fmt.Sprintf("Injected handler for %s must be a function without results, not %s.", pattern, fnType))
+	}
+
+	handler := injectedHandler{injector, pattern, fnValue, make([]inject.Key, fnType.NumIn())}
+	seen := make(map[inject.Key]bool)
+	remaining := keys
+	for i := range handler.keys {
+		paramType := fnType.In(i)
+		if paramType == responseWriterType || paramType == requestType {
+			continue
+		}
+		if len(keys) == 0 {
+			handler.keys[i] = paramType
+		} else if len(remaining) > 0 {
+			handler.keys[i], remaining = remaining[0], remaining[1:]
+		} else {
+			panic(fmt.Sprintf("Injected handler for %s has more parameters than the %d keys given.", pattern, len(keys)))
+		}
+		if seen[handler.keys[i]] {
+			panic(fmt.Sprintf("Injected handler for %s looks up %v more than once.", pattern, handler.keys[i]))
+		}
+		seen[handler.keys[i]] = true
+	}
+	if len(remaining) > 0 {
+		panic(fmt.Sprintf("Injected handler for %s has fewer parameters than the %d keys given.", pattern, len(keys)))
+	}
+	return handler
+}
+
+func (this injectedHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	args, err := this.resolve(writer, request)
+	if err != nil {
+		log.Printf("Unable to inject the handler for %s when serving %s: %v", this.pattern, request.URL, err)
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	this.fn.Call(args)
+}
+
+// Resolves the arguments of the function, returning an error if any cannot be resolved.
+func (this injectedHandler) resolve(writer http.ResponseWriter, request *http.Request) (args []reflect.Value, err error) {
+	container := this.injector.CreateContainer()
+	fnType := this.fn.Type()
+	args = make([]reflect.Value, len(this.keys))
+	for i, key := range this.keys {
+		paramType := fnType.In(i)
+		switch {
+		case key != nil:
+			value, err := inject.TryGetInstance(container, request, key)
+			if err != nil {
+				return nil, err
+			} else if value == nil {
+				args[i] = reflect.Zero(paramType)
+			} else if reflect.TypeOf(value).AssignableTo(paramType) {
+				args[i] = reflect.ValueOf(value)
+			} else {
+				return nil, fmt.Errorf("%v provided %T, which cannot be passed as parameter %d (%s)", key, value, i, paramType)
+			}
+		case paramType == responseWriterType:
+			args[i] = reflect.ValueOf(writer)
+		default:
+			args[i] = reflect.ValueOf(request)
+		}
+	}
+	return args, nil
+}
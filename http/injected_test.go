@@ -0,0 +1,88 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http_test
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/http"
+	"code.google.com/p/go-inject/http/httptest"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type Counter struct{}
+type Missing struct{}
+
+func TestInjectedHandlerResolvesParameters(t *testing.T) {
+	injector := inject.CreateInjector()
+	inject_http.ConfigureScopes(injector)
+	inject_http.ConfigureInjector(injector)
+	i := 0
+	injector.BindInScope(Counter{}, func(_ inject.Context, _ inject.Container) interface{} {
+		i += 1
+		return i
+	}, inject_http.RequestScoped{})
+	injector.BindInstance(reflect.TypeOf(""), "Hello")
+
+	inject_http.BindInjectedHandler(injector, "/keys",
+		func(w http.ResponseWriter, count int, request *http.Request, header http.Header) {
+			fmt.Fprintf(w, "%d %s %s", count, request.URL.Path, header.Get("X-Name"))
+		},
+		Counter{}, inject_http.Header{})
+	inject_http.BindInjectedHandler(injector, "/types", func(w http.ResponseWriter, greeting string) {
+		fmt.Fprint(w, greeting)
+	})
+
+	harness := inject_httptest.New(injector)
+	for count := 1; count <= 2; count++ {
+		request := httptest.NewRequest(http.MethodGet, "/keys", nil)
+		request.Header.Set("X-Name", "name")
+		expected := fmt.Sprintf("%d /keys name", count)
+		if body := harness.Do(request).Body.String(); body != expected {
+			t.Errorf("Expected %q, got %q", expected, body)
+		}
+	}
+	if body := harness.Get("/types").Body.String(); body != "Hello" {
+		t.Errorf("Expected \"Hello\", got %q", body)
+	}
+}
+
+func TestInjectedHandlerFailsWith500(t *testing.T) {
+	injector := inject.CreateInjector()
+	inject_http.ConfigureScopes(injector)
+	inject_http.ConfigureInjector(injector)
+	inject_http.BindInjectedHandler(injector, "/", func(_ http.ResponseWriter, _ string) {
+		t.Error("Expected the handler not to be called")
+	}, Missing{})
+
+	if response := inject_httptest.New(injector).Get("/"); response.Code != http.StatusInternalServerError {
+		t.Errorf("Expected a 500, got %d", response.Code)
+	}
+}
+
+func TestInjectedHandlerRejectsMismatchedKeys(t *testing.T) {
+	injector := inject.CreateInjector()
+	inject_http.ConfigureInjector(injector)
+	defer func() {
+		recover() // Expected
+	}()
+	inject_http.BindInjectedHandler(injector, "/", func(_ string, _ int) {}, Counter{})
+	t.Error("Expected a panic when a parameter has no key")
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/multi"
+	"fmt"
+	"net"
+)
+
+// Returns the optional binding of the listener the server accepts connections on.
+func boundListener(injector inject.Injector) inject_multi.OptionalOf[net.Listener] {
+	return inject_multi.EnsureOptionalOfBound[net.Listener](injector, Listener{})
+}
+
+// Provides the default listener, a TCP listener on Port.
+func providesListener(_ inject.Context, container inject.Container) net.Listener {
+	port := container.GetInstance(nil, Port{}).(int)
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		panic(fmt.Sprintf("Unable to listen on port %d: %v", port, err))
+	}
+	return listener
+}
+
+// Binds the listener the server accepts connections on, in place of a TCP listener on Port.
+func BindListener(injector inject.Injector, listener net.Listener) {
+	boundListener(injector).BindInstance(listener)
+}
+
+/*
+	Binds a Unix domain socket at path as the listener the server accepts connections on. The
+	socket is created when the listener is first looked up.
+*/
+func BindUnixListener(injector inject.Injector, path string) {
+	boundListener(injector).BindInScope(func(_ inject.Context, _ inject.Container) net.Listener {
+		listener, err := net.Listen("unix", path)
+		if err != nil {
+			panic(fmt.Sprintf("Unable to listen on Unix socket %s: %v", path, err))
+		}
+		return listener
+	}, inject.Singleton{})
+}
+
+/*
+	Returns the address the server bound in the injector listens on. This creates the listener if
+	it does not exist yet, so it can be used to discover an ephemeral port before calling Run.
+*/
+func Addr(injector inject.Injector) net.Addr {
+	return injector.CreateContainer().GetInstance(nil, Listener{}).(net.Listener).Addr()
+}
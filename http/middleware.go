@@ -0,0 +1,86 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/multi"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Container key for the middleware wrapping each handler.
+type Middleware struct{}
+
+type middleware struct {
+	priority int
+
+	// The path pattern of the handlers to wrap, or "" to wrap every handler.
+	pattern string
+
+	wrap func(http.Handler) http.Handler
+}
+
+// Whether the middleware wraps the handler bound to route.
+func (this middleware) matches(route Route) bool {
+	pattern := route.Pattern
+	if this.pattern == "" || this.pattern == pattern {
+		return true
+	}
+	return strings.HasSuffix(this.pattern, "/") && strings.HasPrefix(pattern, this.pattern)
+}
+
+// Returns the set of middleware.
+func middlewareSet(injector inject.Injector) inject_multi.SetOf[middleware] {
+	return inject_multi.EnsureSetOfBound[middleware](injector, Middleware{})
+}
+
+/*
+	Binds middleware that wraps every handler. Middleware with a lower priority runs first, so it
+	wraps middleware with a higher priority; middleware with the same priority runs in the order it
+	was bound. Middleware runs inside the request scope, so it can look up request-scoped bindings
+	using the *http.Request as the context.
+*/
+func BindMiddleware(injector inject.Injector, priority int, wrap func(http.Handler) http.Handler) {
+	middlewareSet(injector).BindInstance(middleware{priority, "", wrap})
+}
+
+/*
+	Binds middleware that wraps only the handlers whose route has the path pattern or, if pattern
+	ends in a slash, a path pattern beneath it. See BindMiddleware.
+*/
+func BindMiddlewareForPattern(injector inject.Injector, priority int, pattern string, wrap func(http.Handler) http.Handler) {
+	middlewareSet(injector).BindInstance(middleware{priority, pattern, wrap})
+}
+
+// Wraps the handler bound to route in the matching middleware, in priority order.
+func wrapMiddleware(all []middleware, route Route, handler http.Handler) http.Handler {
+	matching := make([]middleware, 0, len(all))
+	for _, middleware := range all {
+		if middleware.matches(route) {
+			matching = append(matching, middleware)
+		}
+	}
+	sort.SliceStable(matching, func(i, j int) bool { return matching[i].priority < matching[j].priority })
+
+	// Wrap from the innermost (highest priority) outwards.
+	for i := len(matching) - 1; i >= 0; i-- {
+		handler = matching[i].wrap(handler)
+	}
+	return handler
+}
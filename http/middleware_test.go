@@ -0,0 +1,76 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http_test
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/http"
+	"code.google.com/p/go-inject/http/httptest"
+	"net/http"
+	"testing"
+)
+
+type Trace struct{}
+
+// Returns middleware that appends name to the request-scoped trace.
+func tracing(injector inject.Injector, name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+			trace := injector.CreateContainer().GetInstance(request, Trace{}).(*[]string)
+			*trace = append(*trace, name)
+			next.ServeHTTP(w, request)
+		})
+	}
+}
+
+func TestMiddlewareRunsInPriorityOrderInsideRequestScope(t *testing.T) {
+	injector := inject.CreateInjector()
+	inject_http.ConfigureScopes(injector)
+	inject_http.ConfigureInjector(injector)
+	injector.BindInScope(Trace{}, func(_ inject.Context, _ inject.Container) interface{} {
+		return &[]string{}
+	}, inject_http.RequestScoped{})
+
+	inject_http.BindMiddleware(injector, 20, tracing(injector, "logging"))
+	inject_http.BindMiddleware(injector, 10, tracing(injector, "auth"))
+	inject_http.BindMiddlewareForPattern(injector, 15, "/admin/", tracing(injector, "admin"))
+	inject_http.BindMiddleware(injector, 20, tracing(injector, "gzip"))
+
+	var traces []string
+	handler := func(w http.ResponseWriter, request *http.Request) {
+		for _, name := range *injector.CreateContainer().GetInstance(request, Trace{}).(*[]string) {
+			traces = append(traces, name)
+		}
+		traces = append(traces, request.URL.Path)
+	}
+	inject_http.BindHandlerFunc(injector, "/", handler)
+	inject_http.BindHandlerFunc(injector, "/admin/", handler)
+
+	harness := inject_httptest.New(injector)
+	harness.Get("/")
+	harness.Get("/admin/users")
+
+	expected := []string{"auth", "logging", "gzip", "/", "auth", "admin", "logging", "gzip", "/admin/users"}
+	if len(traces) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, traces)
+	}
+	for i := range expected {
+		if traces[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected, traces)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http
+
+import (
+	"code.google.com/p/go-inject"
+	"context"
+	"net/http"
+)
+
+// Key in a request's context for the function that records request-scoped provisions.
+type provisionRecorderKey struct{}
+
+/*
+	Returns a copy of request that calls record with the key of each request-scoped value that is
+	provisioned while serving it. Values already cached in the request scope are not recorded. This
+	is intended for tests; see the inject_httptest package.
+*/
+func RecordProvisions(request *http.Request, record func(inject.Key)) *http.Request {
+	return request.WithContext(context.WithValue(request.Context(), provisionRecorderKey{}, record))
+}
+
+// Wraps the request scope to report provisioned keys to the request's recorder, if any.
+type recordingScope struct {
+	scope inject.Scope
+}
+
+func (this recordingScope) Scope(key inject.Key, provider inject.Provider) inject.Provider {
+	// Keys bound in child injectors, like those of route groups, are recorded as they were bound.
+	recorded := key
+	if owned, ok := key.(inject.OwnedKey); ok {
+		recorded = owned.Key
+	}
+	return this.scope.Scope(key, func(context inject.Context, container inject.Container) interface{} {
+		if request, ok := context.(*http.Request); ok {
+			if record, ok := request.Context().Value(provisionRecorderKey{}).(func(inject.Key)); ok {
+				record(recorded)
+			}
+		}
+		return provider(context, container)
+	})
+}
+
+func (this recordingScope) Cached() []inject.CachedValues {
+	if inspectable, ok := this.scope.(inject.InspectableScope); ok {
+		return inspectable.Cached()
+	}
+	return nil
+}
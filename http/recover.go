@@ -0,0 +1,101 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http
+
+import (
+	"code.google.com/p/go-inject"
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strings"
+)
+
+// The stages the server may run in. See the http_stage flag.
+const (
+	Production  = "production"
+	Development = "development"
+)
+
+// Value for the http_stage flag (default: production)
+var stage *string = flag.String(
+	"http_stage",
+	Production,
+	"the stage the http server runs in. In development, panics in handlers are described in the response")
+
+// The description of a key that failed to be provided, for the development error page.
+type failedKey struct {
+	Key    string
+	Source string
+}
+
+var errorTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Internal Server Error</title></head>
+<body>
+<h1>Internal Server Error</h1>
+<p>Panic serving {{.Method}} {{.URL}}: {{.Cause}}</p>
+{{if .Chain}}
+<h2>Keys being provided</h2>
+<table border="1">
+<tr><th>Key</th><th>Bound at</th></tr>
+{{range .Chain}}<tr><td>{{.Key}}</td><td>{{if .Source}}{{.Source}}{{else}}(not bound){{end}}</td></tr>
+{{end}}
+</table>
+{{end}}
+<h2>Stack</h2>
+<pre>{{.Stack}}</pre>
+</body>
+</html>`))
+
+/*
+	Responds with a 500 to a request whose handler panicked with cause, and logs the panic. In the
+	development stage, the response describes the panic, including the chain of keys that were
+	being provided if the panic is an *inject.ProvisionError, as lookups made with the request
+	panic with.
+*/
+func recovered(writer http.ResponseWriter, request *http.Request, cause interface{}) {
+	stack := string(debug.Stack())
+	var chain []failedKey
+	if err, ok := cause.(*inject.ProvisionError); ok {
+		for i, key := range err.Chain {
+			chain = append(chain, failedKey{inject.FormatKey(key), err.Sources[i]})
+		}
+	}
+
+	details := []string{fmt.Sprintf("Panic serving %s %s: %v", request.Method, request.URL, cause)}
+	for _, key := range chain {
+		details = append(details, fmt.Sprintf("  providing %s (bound at %s)", key.Key, key.Source))
+	}
+	log.Printf("%s\n%s", strings.Join(details, "\n"), stack)
+
+	if *stage != Development {
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writer.WriteHeader(http.StatusInternalServerError)
+	errorTemplate.Execute(writer, struct {
+		Method string
+		URL    string
+		Cause  string
+		Chain  []failedKey
+		Stack  string
+	}{request.Method, request.URL.String(), fmt.Sprint(cause), chain, stack})
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http_test
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/http"
+	"code.google.com/p/go-inject/http/httptest"
+	"flag"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type Unbound struct{}
+type Needy struct{}
+
+// Returns an injector with a handler that looks up Needy, which depends on the unbound Unbound.
+func panickingInjector() inject.Injector {
+	injector := inject.CreateInjector()
+	inject_http.ConfigureScopes(injector)
+	inject_http.ConfigureInjector(injector)
+	injector.Bind(Needy{}, func(context inject.Context, container inject.Container) interface{} {
+		return container.GetInstance(context, Unbound{})
+	})
+	inject_http.BindHandlerFunc(injector, "/", func(w http.ResponseWriter, r *http.Request) {
+		injector.CreateContainer().GetInstance(r, Needy{})
+	})
+	return injector
+}
+
+func TestPanicRespondsWith500AndExitsScope(t *testing.T) {
+	injector := panickingInjector()
+	response := inject_httptest.New(injector).Get("/")
+	if response.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500, got %d", response.Code)
+	}
+	if body := response.Body.String(); strings.Contains(body, "Needy") {
+		t.Errorf("Expected production responses not to describe the panic, got %q", body)
+	}
+	for _, scope := range inject.Describe(injector).Scopes {
+		if scope.Tag == (inject_http.RequestScoped{}) && len(scope.Cached) != 0 {
+			t.Errorf("Expected the request scope to be exited, got %+v", scope.Cached)
+		}
+	}
+}
+
+func TestPanicInDevelopmentDescribesKeyChain(t *testing.T) {
+	flag.Set("http_stage", inject_http.Development)
+	defer flag.Set("http_stage", inject_http.Production)
+
+	response := inject_httptest.New(panickingInjector()).Get("/")
+	body := response.Body.String()
+	if response.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500, got %d", response.Code)
+	}
+	for _, expected := range []string{"Needy", "Unbound", "recover_test.go", "(not bound)"} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected %q in the error page:\n%s", expected, body)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http
+
+import (
+	"code.google.com/p/go-inject"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// Request-scoped container key for the *http.Request being served.
+type Request struct{}
+
+// Request-scoped container key for the http.ResponseWriter of the request being served.
+type ResponseWriter struct{}
+
+// Request-scoped container key for the context.Context of the request being served.
+type RequestContext struct{}
+
+// Request-scoped container key for the http.Header of the request being served.
+type Header struct{}
+
+/*
+	Request-scoped container key for the path values of the request being served, a
+	map[string]string from each wildcard in the matched pattern to its value.
+*/
+type PathValues struct{}
+
+/*
+	Request-scoped container key for the ID of the request being served, a string. This is the value
+	of the request's X-Request-Id header, or a random ID if it has none.
+*/
+type RequestID struct{}
+
+// The header holding the ID of a request. See RequestID.
+const RequestIDHeader = "X-Request-Id"
+
+func providesRequestID(context inject.Context, container inject.Container) interface{} {
+	if id := container.GetInstance(context, Request{}).(*http.Request).Header.Get(RequestIDHeader); id != "" {
+		return id
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Returns a provider for a key that is seeded when serving a request rather than provided.
+func seeded(key inject.Key) inject.Provider {
+	return func(_ inject.Context, _ inject.Container) interface{} {
+		panic(fmt.Sprintf("%s is only available while inject_http is serving a request.", key))
+	}
+}
+
+// Binds the keys seeded into the request scope for every request.
+func bindSeededKeys(injector inject.Injector) {
+	for _, key := range []inject.Key{Request{}, ResponseWriter{}, RequestContext{}, Header{}, PathValues{}} {
+		injector.BindInScope(key, seeded(key), RequestScoped{})
+	}
+}
+
+/*
+	The context the request scope is entered with while a request is served. It is held in the
+	context of the request, so requests derived from it with WithContext share its request scope.
+*/
+type servedRequest struct {
+	// The request as last seeded, which is the context passed to request-scoped providers.
+	request atomic.Pointer[http.Request]
+}
+
+// Key in a request's context for its servedRequest.
+type servedRequestKey struct{}
+
+/*
+	Returns the context the request scope holds the values of the request in, or the context itself
+	if it is not a request being served.
+*/
+func servedContext(context inject.Context) inject.Context {
+	if request, ok := context.(*http.Request); ok {
+		if served, ok := request.Context().Value(servedRequestKey{}).(*servedRequest); ok {
+			return served
+		}
+	}
+	return context
+}
+
+/*
+	Wraps the request scope so that values are looked up with the *http.Request being served, or
+	any request derived from it, as the context, and are provided with the request as last seeded.
+*/
+type servedRequestScope struct {
+	scope inject.SimpleScope
+}
+
+func (this servedRequestScope) Scope(key inject.Key, provider inject.Provider) inject.Provider {
+	scoped := this.scope.Scope(key, func(context inject.Context, container inject.Container) interface{} {
+		return provider(context.(*servedRequest).request.Load(), container)
+	})
+	return func(context inject.Context, container inject.Container) interface{} {
+		return scoped(servedContext(context), container)
+	}
+}
+
+func (this servedRequestScope) Cached() []inject.CachedValues {
+	inspectable, ok := this.scope.(inject.InspectableScope)
+	if !ok {
+		return nil
+	}
+	cached := inspectable.Cached()
+	for i := range cached {
+		if served, ok := cached[i].Context.(*servedRequest); ok {
+			cached[i].Context = served.request.Load()
+		}
+	}
+	return cached
+}
+
+// Seeds the request scope with the values of the request being served.
+func seedRequestScope(writer http.ResponseWriter, request *http.Request) {
+	served := request.Context().Value(servedRequestKey{}).(*servedRequest)
+	served.request.Store(request)
+	requestScope.Seed(served, Request{}, request)
+	requestScope.Seed(served, ResponseWriter{}, writer)
+	requestScope.Seed(served, RequestContext{}, request.Context())
+	requestScope.Seed(served, Header{}, request.Header)
+	requestScope.Seed(served, PathValues{}, pathValues(request))
+}
+
+/*
+	Reseeds the request scope before calling the handler, so that the seeded values are those the
+	handler is called with rather than those middleware replaced.
+*/
+type seedingHandler struct {
+	handler http.Handler
+}
+
+func (this seedingHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	seedRequestScope(writer, request)
+	this.handler.ServeHTTP(writer, request)
+}
+
+// Returns the value of each wildcard in the pattern that matched the request.
+func pathValues(request *http.Request) map[string]string {
+	values := make(map[string]string)
+	pattern := request.Pattern
+	for {
+		start := strings.Index(pattern, "{")
+		if start < 0 {
+			return values
+		}
+		end := strings.Index(pattern[start:], "}")
+		if end < 0 {
+			return values
+		}
+		name := strings.TrimSuffix(pattern[start+1:start+end], "...")
+		if name != "$" {
+			values[name] = request.PathValue(name)
+		}
+		pattern = pattern[start+end+1:]
+	}
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http_test
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/http"
+	"code.google.com/p/go-inject/http/httptest"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type Item struct{}
+
+func TestRequestValuesAreSeededInRequestScope(t *testing.T) {
+	injector := inject.CreateInjector()
+	inject_http.ConfigureScopes(injector)
+	inject_http.ConfigureInjector(injector)
+	// A request-scoped provider that depends on the seeded keys.
+	injector.BindInScope(Item{}, func(context inject.Context, container inject.Container) interface{} {
+		pathValues := container.GetInstance(context, inject_http.PathValues{}).(map[string]string)
+		header := container.GetInstance(context, inject_http.Header{}).(http.Header)
+		return fmt.Sprintf("%s/%s (%s)", pathValues["id"], pathValues["rest"], header.Get("X-Item"))
+	}, inject_http.RequestScoped{})
+
+	inject_http.BindHandlerFunc(injector, "/items/{id}/{rest...}", func(_ http.ResponseWriter, request *http.Request) {
+		container := injector.CreateContainer()
+		if container.GetInstance(request, inject_http.Request{}) != request {
+			t.Error("Expected the seeded request to be the request being served")
+		}
+		if container.GetInstance(request, inject_http.RequestContext{}) != request.Context() {
+			t.Error("Expected the seeded context to be the context of the request")
+		}
+		writer := container.GetInstance(request, inject_http.ResponseWriter{}).(http.ResponseWriter)
+		writer.Write([]byte(container.GetInstance(request, Item{}).(string)))
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/items/42/a/b", nil)
+	request.Header.Set("X-Item", "header")
+	response := inject_httptest.New(injector).Do(request)
+	if body := response.Body.String(); body != "42/a/b (header)" {
+		t.Errorf("Expected \"42/a/b (header)\", got %q", body)
+	}
+	if len(response.Provisioned) != 1 || response.Provisioned[0] != (Item{}) {
+		t.Errorf("Expected only Item to be provisioned, got %v", response.Provisioned)
+	}
+}
+
+func TestSeededKeysAreUnavailableOutsideRequests(t *testing.T) {
+	injector := inject.CreateInjector()
+	inject_http.ConfigureScopes(injector)
+	defer func() {
+		recover() // Expected
+	}()
+	injector.CreateContainer().GetInstance(nil, inject_http.Request{})
+	t.Error("Expected a panic when looking up the request outside of a request")
+}
+
+func TestConcurrentRequestsAreScopedSeparately(t *testing.T) {
+	injector := inject.CreateInjector()
+	inject_http.ConfigureScopes(injector)
+	inject_http.ConfigureInjector(injector)
+	injector.BindInScope(Item{}, func(context inject.Context, container inject.Container) interface{} {
+		return container.GetInstance(context, inject_http.PathValues{}).(map[string]string)["id"]
+	}, inject_http.RequestScoped{})
+	inject_http.BindHandlerFunc(injector, "/items/{id}", func(writer http.ResponseWriter, request *http.Request) {
+		first := injector.CreateContainer().GetInstance(request, Item{}).(string)
+		second := injector.CreateContainer().GetInstance(request, Item{}).(string)
+		fmt.Fprintf(writer, "%s %s", first, second)
+	})
+
+	harness := inject_httptest.New(injector)
+	var wait sync.WaitGroup
+	for item := 0; item < 50; item++ {
+		wait.Add(1)
+		go func(id string) {
+			defer wait.Done()
+			response := harness.Do(httptest.NewRequest(http.MethodGet, "/items/"+id, nil))
+			if body := response.Body.String(); body != id+" "+id {
+				t.Errorf("Expected %q, got %q", id+" "+id, body)
+			}
+		}(fmt.Sprint(item))
+	}
+	wait.Wait()
+}
+
+type contextValue struct{}
+
+func TestRequestScopeFollowsRequestsDerivedWithContext(t *testing.T) {
+	injector := inject.CreateInjector()
+	inject_http.ConfigureScopes(injector)
+	inject_http.ConfigureInjector(injector)
+	provided := 0
+	injector.BindInScope(Item{}, func(context inject.Context, _ inject.Container) interface{} {
+		provided++
+		return context.(*http.Request).Context().Value(contextValue{})
+	}, inject_http.RequestScoped{})
+	inject_http.BindMiddleware(injector, 0, func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			// Looked up before and after replacing the request, as with a tracing middleware.
+			injector.CreateContainer().GetInstance(request, inject_http.RequestID{})
+			request = request.WithContext(context.WithValue(request.Context(), contextValue{}, "middleware"))
+			handler.ServeHTTP(writer, request)
+		})
+	})
+	inject_http.BindHandlerFunc(injector, "/", func(writer http.ResponseWriter, request *http.Request) {
+		container := injector.CreateContainer()
+		if container.GetInstance(request, inject_http.Request{}) != request {
+			t.Error("Expected the seeded request to be the request the handler is called with")
+		}
+		if container.GetInstance(request, inject_http.RequestContext{}) != request.Context() {
+			t.Error("Expected the seeded context to be the context the handler is called with")
+		}
+		fmt.Fprintf(writer, "%v %v", container.GetInstance(request, Item{}), injector.CreateContainer().GetInstance(request, Item{}))
+	})
+
+	response := inject_httptest.New(injector).Get("/")
+	if body := response.Body.String(); body != "middleware middleware" {
+		t.Errorf("Expected \"middleware middleware\", got %q", body)
+	}
+	if provided != 1 {
+		t.Errorf("Expected Item to be provided once, got %d", provided)
+	}
+	if len(response.Provisioned) != 2 {
+		t.Errorf("Expected RequestID and Item to be provisioned, got %v", response.Provisioned)
+	}
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/multi"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+/*
+	A route that a handler is bound to, in the terms of the patterns accepted by http.ServeMux. An
+	empty Method matches every method and an empty Host matches every host. Pattern is the path
+	pattern, which may contain wildcards like "/items/{id}".
+*/
+type Route struct {
+	Method  string
+	Host    string
+	Pattern string
+}
+
+// Parses a http.ServeMux pattern like "GET example.com/items/{id}" into a Route.
+func ParseRoute(pattern string) Route {
+	var route Route
+	if space := strings.IndexAny(pattern, " \t"); space >= 0 {
+		route.Method, pattern = pattern[:space], strings.TrimLeft(pattern[space:], " \t")
+	}
+	if slash := strings.Index(pattern, "/"); slash >= 0 {
+		route.Host, route.Pattern = pattern[:slash], pattern[slash:]
+	} else {
+		route.Pattern = pattern
+	}
+	return route
+}
+
+// Returns the route as a http.ServeMux pattern.
+func (this Route) String() string {
+	if this.Method == "" {
+		return this.Host + this.Pattern
+	}
+	return this.Method + " " + this.Host + this.Pattern
+}
+
+// A route along with where it was bound.
+type boundRoute struct {
+	Route
+	source string
+}
+
+type routesKey struct {
+	injector inject.Injector
+	server   inject.Tag
+}
+
+// The routes bound to each server in each injector, across both the handler and handler func maps.
+var routes = make(map[routesKey][]boundRoute)
+
+// Returns the panic from registering the routes on a http.ServeMux, or nil if they can coexist.
+func register(routes ...Route) (conflict interface{}) {
+	defer func() {
+		conflict = recover()
+	}()
+	serveMux := http.NewServeMux()
+	for _, route := range routes {
+		serveMux.Handle(route.String(), http.NotFoundHandler())
+	}
+	return nil
+}
+
+/*
+	Records a route bound in the injector, panicking if the route is invalid or conflicts with a
+	route that is already bound. Routes conflict when http.ServeMux would refuse to register both:
+	for example "/items/" bound both as a handler and as a handler func, or "/items/{id}" and
+	"/{kind}/latest", where neither is more specific than the other.
+*/
+func checkRoute(injector inject.Injector, server inject.Tag, route Route) {
+	key := routesKey{injector, server}
+	source := inject_multi.CallerSource()
+	if invalid := register(route); invalid != nil {
+		panic(fmt.Sprintf("Route %q bound at %s is invalid: %v", route, source, invalid))
+	}
+	for _, bound := range routes[key] {
+		if conflict := register(bound.Route, route); conflict != nil {
+			panic(fmt.Sprintf("Route %q bound at %s conflicts with route %q bound at %s.",
+				route, source, bound.Route, bound.source))
+		}
+	}
+	routes[key] = append(routes[key], boundRoute{route, source})
+}
+
+// Binds a http.Handler to a route. Binding a conflicting route panics, naming both callers.
+func BindRoute(injector inject.Injector, route Route, handler http.Handler) {
+	checkRoute(injector, nil, route)
+	handlers(injector, nil).BindInstance(route, handler)
+}
+
+// Binds a handler func to a route. Binding a conflicting route panics, naming both callers.
+func BindRouteFunc(injector inject.Injector, route Route, handlerFunc func(http.ResponseWriter, *http.Request)) {
+	checkRoute(injector, nil, route)
+	handlerFuncs(injector, nil).BindInstance(route, handlerFunc)
+}
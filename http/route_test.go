@@ -0,0 +1,89 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http_test
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/http"
+	"code.google.com/p/go-inject/http/httptest"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseRoute(t *testing.T) {
+	route := inject_http.ParseRoute("GET example.com/items/{id}")
+	if route != (inject_http.Route{"GET", "example.com", "/items/{id}"}) {
+		t.Errorf("Expected GET, example.com and /items/{id}, got %#v", route)
+	}
+	if route.String() != "GET example.com/items/{id}" {
+		t.Errorf("Expected the route to format as its pattern, got %q", route)
+	}
+	if route := inject_http.ParseRoute("/"); route != (inject_http.Route{Pattern: "/"}) {
+		t.Errorf("Expected only the / path pattern, got %#v", route)
+	}
+}
+
+func TestRoutesByMethodAndHost(t *testing.T) {
+	injector := inject.CreateInjector()
+	inject_http.ConfigureScopes(injector)
+	inject_http.ConfigureInjector(injector)
+	respond := func(body string) func(http.ResponseWriter, *http.Request) {
+		return func(w http.ResponseWriter, _ *http.Request) { fmt.Fprint(w, body) }
+	}
+	inject_http.BindRouteFunc(injector, inject_http.Route{Method: "GET", Pattern: "/items"}, respond("get"))
+	inject_http.BindRouteFunc(injector, inject_http.Route{Method: "POST", Pattern: "/items"}, respond("post"))
+	inject_http.BindHandlerFunc(injector, "example.com/items", respond("host"))
+
+	harness := inject_httptest.New(injector)
+	for _, test := range []struct{ method, target, expected string }{
+		{http.MethodGet, "http://localhost/items", "get"},
+		{http.MethodPost, "http://localhost/items", "post"},
+		{http.MethodGet, "http://example.com/items", "host"},
+	} {
+		if body := harness.Do(httptest.NewRequest(test.method, test.target, nil)).Body.String(); body != test.expected {
+			t.Errorf("Expected %s %s to respond %q, got %q", test.method, test.target, test.expected, body)
+		}
+	}
+}
+
+func TestConflictingRoutesAcrossHandlersAndFuncsPanic(t *testing.T) {
+	injector := inject.CreateInjector()
+	inject_http.ConfigureInjector(injector)
+	inject_http.BindHandler(injector, "/items/", http.NotFoundHandler())
+	defer func() {
+		message, _ := recover().(string)
+		if strings.Count(message, "route_test.go") != 2 {
+			t.Errorf("Expected the panic to name both bindings, got %q", message)
+		}
+	}()
+	inject_http.BindHandlerFunc(injector, "/items/", http.NotFound)
+	t.Error("Expected a panic when binding /items/ as both a handler and a handler func")
+}
+
+func TestAmbiguousRoutesPanic(t *testing.T) {
+	injector := inject.CreateInjector()
+	inject_http.ConfigureInjector(injector)
+	inject_http.BindHandlerFunc(injector, "/items/{id}", http.NotFound)
+	defer func() {
+		recover() // Expected
+	}()
+	inject_http.BindHandlerFunc(injector, "/{kind}/latest", http.NotFound)
+	t.Error("Expected a panic when binding routes where neither is more specific")
+}
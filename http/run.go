@@ -0,0 +1,134 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http
+
+import (
+	"code.google.com/p/go-inject"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Value for the http_shutdown_timeout flag (default: 30s)
+var shutdownTimeout *time.Duration = flag.Duration(
+	"http_shutdown_timeout",
+	30*time.Second,
+	"how long to wait for in-flight requests to finish when shutting down the http server")
+
+/*
+	Runs the server bound to inject_http.Server{} in the injector on the listener bound to
+	inject_http.Listener{}, until ctx is cancelled or the process receives SIGINT or SIGTERM. Once
+	the server has shut down, as described in RunServer, the injector's shutdown hooks are called.
+	See inject.OnShutdown.
+*/
+func Run(ctx context.Context, injector inject.Injector) error {
+	container := injector.CreateContainer()
+	return serve(ctx, injector, []serving{{
+		container.GetInstance(nil, Server{}).(*http.Server),
+		container.GetInstance(nil, Listener{}).(net.Listener),
+	}})
+}
+
+/*
+	Serves HTTP requests on listener with server until ctx is cancelled or the process receives SIGINT or
+	SIGTERM. The server then stops accepting connections and waits up to the http_shutdown_timeout
+	for in-flight requests to finish, which exits their request scopes. Requests still running after
+	the timeout have their connections closed. If the server has a TLSConfig, it serves HTTPS.
+
+	Returns nil after a graceful shutdown, or an error describing why the server could not be
+	started or drained. The server is not marked ready for a ReadinessHandler (see SetReady), and no
+	shutdown hooks are called (see inject.Shutdown).
+*/
+func RunServer(ctx context.Context, server *http.Server, listener net.Listener) error {
+	return serve(ctx, nil, []serving{{server, listener}})
+}
+
+// A server along with the listener it serves on.
+type serving struct {
+	server   *http.Server
+	listener net.Listener
+}
+
+func (this serving) serve() error {
+	if this.server.TLSConfig != nil {
+		log.Printf("Serving HTTPS on %s", this.listener.Addr())
+		return this.server.ServeTLS(this.listener, "", "")
+	}
+	log.Printf("Serving HTTP on %s", this.listener.Addr())
+	return this.server.Serve(this.listener)
+}
+
+/*
+	Serves with every server until ctx is cancelled, the process receives SIGINT or SIGTERM, or any
+	server stops, then shuts every server down together. The injector, if any, is marked ready while
+	the servers are running, and its shutdown hooks are called once they have shut down. See
+	RunServer.
+*/
+func serve(ctx context.Context, injector inject.Injector, servers []serving) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	served := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server serving) {
+			err := server.serve()
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				err = fmt.Errorf("inject_http: unable to serve HTTP on %s: %w", server.listener.Addr(), err)
+			} else {
+				err = nil
+			}
+			served <- err
+		}(server)
+	}
+	if injector != nil {
+		SetReady(injector, true)
+	}
+
+	var errs []error
+	select {
+	case err := <-served:
+		errs = append(errs, err)
+	case <-ctx.Done():
+	}
+
+	if injector != nil {
+		SetReady(injector, false)
+	}
+	drainCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		addr := server.listener.Addr()
+		log.Printf("Shutting down HTTP server on %s", addr)
+		if err := server.server.Shutdown(drainCtx); err != nil {
+			server.server.Close()
+			errs = append(errs, fmt.Errorf("inject_http: in-flight requests on %s did not finish within %s: %w",
+				addr, *shutdownTimeout, err))
+		}
+	}
+	if injector != nil {
+		errs = append(errs, inject.Shutdown(injector))
+	}
+	return errors.Join(errs...)
+}
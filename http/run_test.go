@@ -0,0 +1,96 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http_test
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/http"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+// Returns an injector serving "hello" on "/", with the listener bound by listen.
+func helloInjector(listen func(inject.Injector)) inject.Injector {
+	injector := inject.CreateInjector()
+	inject_http.ConfigureScopes(injector)
+	inject_http.ConfigureInjector(injector)
+	listen(injector)
+	inject_http.BindHandlerFunc(injector, "/", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, "hello")
+	})
+	return injector
+}
+
+// Runs the server bound in the injector, checks that client gets "hello" from it, then shuts it down.
+func runAndGet(t *testing.T, injector inject.Injector, client *http.Client, url string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- inject_http.Run(ctx, injector)
+	}()
+
+	response, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if string(body) != "hello" {
+		t.Errorf("Expected \"hello\", got %q", body)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Expected Run to shut down cleanly, got %v", err)
+	}
+	if _, err := client.Get(url); err == nil {
+		t.Error("Expected the server to stop accepting connections after shutting down")
+	}
+}
+
+func TestRunOnEphemeralPort(t *testing.T) {
+	injector := helloInjector(func(injector inject.Injector) {
+		injector.BindInstance(inject_http.Port{}, 0)
+	})
+	addr := inject_http.Addr(injector).(*net.TCPAddr)
+	if addr.Port == 0 {
+		t.Fatal("Expected Addr to report the ephemeral port")
+	}
+	runAndGet(t, injector, http.DefaultClient, fmt.Sprintf("http://localhost:%d/", addr.Port))
+}
+
+func TestRunOnUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "http.sock")
+	injector := helloInjector(func(injector inject.Injector) {
+		inject_http.BindUnixListener(injector, path)
+	})
+	if addr := inject_http.Addr(injector); addr.Network() != "unix" || addr.String() != path {
+		t.Errorf("Expected Addr to report the socket %s, got %s %s", path, addr.Network(), addr)
+	}
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", path)
+		},
+	}}
+	runAndGet(t, injector, client, "http://unix/")
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/multi"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+)
+
+// Container key for the map of servers declared with DeclareServer, by tag.
+type Servers struct{}
+
+// The configuration of a server declared with DeclareServer.
+type ServerConfig struct {
+	// The TCP address to listen on, like ":8080". Port 0 listens on an ephemeral port.
+	Addr string
+
+	/*
+		If set, the server serves HTTPS with this configuration. Otherwise, the server serves HTTPS
+		if a certificate is bound with BindCertificate, BindCertificateFiles or
+		BindReloadingCertificateFiles, like the server bound by ConfigureInjector.
+	*/
+	TLSConfig *tls.Config
+}
+
+// Returns the map of declared servers.
+func servers(injector inject.Injector) inject_multi.MapOf[inject.Tag, ServerConfig] {
+	return inject_multi.EnsureMapOfBound[inject.Tag, ServerConfig](injector, Servers{})
+}
+
+/*
+	Declares a server identified by tag, as an alternative to configuring a child injector per
+	server. Handlers are routed to the server with BindServerHandler, BindServerHandlerFunc,
+	BindServerRoute and BindServerRouteFunc, and every declared server is run with RunServers.
+	Declaring the same tag twice panics, naming both callers.
+
+	Binds the following:
+	  inject_http.Servers - a map[inject.Tag]ServerConfig of the declared servers
+	  inject_http.Server<tag> - the *http.Server serving the routes bound to the server
+	  inject_http.Listener<tag> - a TCP listener on the server's address
+	The injector must be configured with ConfigureScopes to serve requests.
+*/
+func DeclareServer(injector inject.Injector, tag inject.Tag, config ServerConfig) {
+	servers(injector).BindInstance(tag, config)
+	certificates(injector)
+	sessions(injector)
+	middlewareSet(injector)
+	handlers(injector, tag)
+	handlerFuncs(injector, tag)
+
+	injector.BindTagged(Server{}, tag, managed(func(_ inject.Context, container inject.Container) interface{} {
+		log.Printf("Creating HTTP server %v", tag)
+		server := &http.Server{Handler: newServeMux(container, tag), TLSConfig: config.TLSConfig}
+		if certificate, ok := boundCertificate(container); ok && server.TLSConfig == nil {
+			server.TLSConfig = NewTLSConfig(certificate)
+		}
+		return server
+	}))
+	injector.BindTagged(Listener{}, tag, managed(func(_ inject.Context, _ inject.Container) interface{} {
+		listener, err := net.Listen("tcp", config.Addr)
+		if err != nil {
+			panic(fmt.Sprintf("Unable to listen on %s for server %v: %v", config.Addr, tag, err))
+		}
+		return listener
+	}))
+}
+
+// Binds a http.Handler to a http.ServeMux pattern on the server declared with the tag.
+func BindServerHandler(injector inject.Injector, server inject.Tag, pattern string, handler http.Handler) {
+	BindServerRoute(injector, server, ParseRoute(pattern), handler)
+}
+
+// Binds a handler func to a http.ServeMux pattern on the server declared with the tag.
+func BindServerHandlerFunc(injector inject.Injector, server inject.Tag, pattern string, handlerFunc func(http.ResponseWriter, *http.Request)) {
+	BindServerRouteFunc(injector, server, ParseRoute(pattern), handlerFunc)
+}
+
+/*
+	Binds a http.Handler to a route on the server declared with the tag. Binding a route that
+	conflicts with another route of the same server panics, naming both callers.
+*/
+func BindServerRoute(injector inject.Injector, server inject.Tag, route Route, handler http.Handler) {
+	checkRoute(injector, server, route)
+	handlers(injector, server).BindInstance(route, handler)
+}
+
+/*
+	Binds a handler func to a route on the server declared with the tag. Binding a route that
+	conflicts with another route of the same server panics, naming both callers.
+*/
+func BindServerRouteFunc(injector inject.Injector, server inject.Tag, route Route, handlerFunc func(http.ResponseWriter, *http.Request)) {
+	checkRoute(injector, server, route)
+	handlerFuncs(injector, server).BindInstance(route, handlerFunc)
+}
+
+/*
+	Returns the address the server declared with the tag listens on, creating its listener if it
+	does not exist yet.
+*/
+func ServerAddr(injector inject.Injector, server inject.Tag) net.Addr {
+	return injector.CreateContainer().GetTaggedInstance(nil, Listener{}, server).(net.Listener).Addr()
+}
+
+/*
+	Runs every server declared with DeclareServer until ctx is cancelled, the process receives
+	SIGINT or SIGTERM, or any of the servers fails. All of the servers are then shut down together,
+	as described in RunServer, and the injector's shutdown hooks are called. See inject.OnShutdown.
+*/
+func RunServers(ctx context.Context, injector inject.Injector) error {
+	declared := injector.CreateContainer().GetTaggedInstance(
+		nil,
+		Servers{},
+		inject_multi.Values{},
+	).(map[inject.Tag]ServerConfig)
+	var all []serving
+	for tag := range declared {
+		// Each server looks up the shared middleware, so each needs its own container.
+		container := injector.CreateContainer()
+		all = append(all, serving{
+			container.GetTaggedInstance(nil, Server{}, tag).(*http.Server),
+			container.GetTaggedInstance(nil, Listener{}, tag).(net.Listener),
+		})
+	}
+	return serve(ctx, injector, all)
+}
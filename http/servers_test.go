@@ -0,0 +1,83 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http_test
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/http"
+	"code.google.com/p/go-inject/http/httptest"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+)
+
+type Public struct{}
+type Admin struct{}
+
+func TestDeclaredServersServeTheirOwnRoutes(t *testing.T) {
+	injector := inject.CreateInjector()
+	inject_http.ConfigureScopes(injector)
+	inject_http.DeclareServer(injector, Public{}, inject_http.ServerConfig{Addr: "localhost:0"})
+	inject_http.DeclareServer(injector, Admin{}, inject_http.ServerConfig{Addr: "localhost:0"})
+	respond := func(body string) func(http.ResponseWriter, *http.Request) {
+		return func(w http.ResponseWriter, _ *http.Request) { fmt.Fprint(w, body) }
+	}
+	// The same route may be bound on each server.
+	inject_http.BindServerHandlerFunc(injector, Public{}, "/", respond("public"))
+	inject_http.BindServerHandlerFunc(injector, Admin{}, "/", respond("admin"))
+
+	if body := inject_httptest.NewTagged(injector, Admin{}).Get("/").Body.String(); body != "admin" {
+		t.Errorf("Expected \"admin\", got %q", body)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	addrs := map[string]string{
+		"public": inject_http.ServerAddr(injector, Public{}).String(),
+		"admin":  inject_http.ServerAddr(injector, Admin{}).String(),
+	}
+	done := make(chan error)
+	go func() {
+		done <- inject_http.RunServers(ctx, injector)
+	}()
+	for expected, addr := range addrs {
+		response, err := http.Get("http://" + addr + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		if string(body) != expected {
+			t.Errorf("Expected %q from %s, got %q", expected, addr, body)
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Expected the servers to shut down cleanly, got %v", err)
+	}
+}
+
+func TestDeclaringServerTwicePanics(t *testing.T) {
+	injector := inject.CreateInjector()
+	inject_http.DeclareServer(injector, Public{}, inject_http.ServerConfig{Addr: ":0"})
+	defer func() {
+		recover() // Expected
+	}()
+	inject_http.DeclareServer(injector, Public{}, inject_http.ServerConfig{Addr: ":0"})
+	t.Error("Expected a panic when declaring the Public server twice")
+}
@@ -0,0 +1,397 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/multi"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope tag for the caching in the context of the session of the *http.Request.
+type SessionScoped struct{}
+
+/*
+	Holds the values of sessions. Values that implement io.Closer are closed when their session
+	expires or is deleted. A store is used concurrently by every request.
+*/
+type SessionStore interface {
+	// Whether the session exists and has not expired. Refreshes the session's idle expiry.
+	Exists(session string) bool
+
+	// Returns the value of the key in the session. Refreshes the session's idle expiry.
+	Get(session string, key inject.Key) (interface{}, bool)
+
+	/*
+		Sets the value of the key in the session, creating the session if it does not exist, unless
+		the key already has a value. Returns the value the session holds and whether it is the value
+		that was put.
+	*/
+	Put(session string, key inject.Key, value interface{}) (interface{}, bool)
+
+	// Deletes the session, closing its values.
+	Delete(session string)
+}
+
+// The configuration of the session scope. See ConfigureSessions.
+type SessionConfig struct {
+	// The name of the session cookie (default: "session").
+	CookieName string
+
+	// The key that the session cookie is signed with. Required.
+	Secret []byte
+
+	// The store holding the values of the sessions (default: a MemorySessionStore expiring sessions
+	// after 30 minutes).
+	Store SessionStore
+}
+
+// Container key for the session scope bound with ConfigureSessions.
+type sessionsKey struct{}
+
+// Returns the optional binding of the session scope.
+func sessions(injector inject.Injector) inject_multi.OptionalOf[*sessionScope] {
+	return inject_multi.EnsureOptionalOfBound[*sessionScope](injector, sessionsKey{})
+}
+
+// Returns the session scope, if one is bound.
+func boundSessions(container inject.Container) (*sessionScope, bool) {
+	return inject_multi.GetOptional[*sessionScope](nil, container, sessionsKey{})
+}
+
+/*
+	Binds the SessionScoped scope. Values bound in SessionScoped are cached in the session of the
+	request being served, so they are reused across the requests of the same user until the session
+	expires. Sessions are identified by a signed cookie, which is set on the response when a session
+	is created; values should be looked up before writing the response's headers.
+*/
+func ConfigureSessions(injector inject.Injector, config SessionConfig) {
+	if len(config.Secret) == 0 {
+		panic("A secret is required to sign the session cookie.")
+	}
+	if config.CookieName == "" {
+		config.CookieName = "session"
+	}
+	if config.Store == nil {
+		config.Store = NewMemorySessionStore(30 * time.Minute)
+	}
+	scope := &sessionScope{config: config}
+	injector.BindScope(scope, SessionScoped{})
+	sessions(injector).BindInstance(scope)
+}
+
+/*
+	The session of a request being served. The request may be served by several goroutines, which
+	share the state.
+*/
+type sessionState struct {
+	writer http.ResponseWriter
+
+	// Guards id and checked.
+	lock sync.Mutex
+
+	// The ID of the session, or "" if the request does not have a valid session cookie.
+	id string
+
+	// Whether the session is known to exist in the store.
+	checked bool
+}
+
+// Key in a request's context for its sessionState.
+type sessionStateKey struct{}
+
+type sessionScope struct {
+	config SessionConfig
+}
+
+// Returns the signature of a session ID.
+func (this *sessionScope) sign(id string) string {
+	mac := hmac.New(sha256.New, this.config.Secret)
+	io.WriteString(mac, id)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+/*
+	Starts serving a request, reading its session from its cookie. Returns a copy of the request
+	holding the session in its context, so requests derived from it share the session.
+*/
+func (this *sessionScope) enter(writer http.ResponseWriter, request *http.Request) *http.Request {
+	state := &sessionState{writer: writer}
+	if cookie, err := request.Cookie(this.config.CookieName); err == nil {
+		id, signature, _ := strings.Cut(cookie.Value, ".")
+		if hmac.Equal([]byte(signature), []byte(this.sign(id))) {
+			state.id = id
+		}
+	}
+	return request.WithContext(context.WithValue(request.Context(), sessionStateKey{}, state))
+}
+
+// Returns the ID of the request's session, creating a session if it has none.
+func (this *sessionScope) session(key inject.Key, scopeContext inject.Context) string {
+	var state *sessionState
+	request, ok := scopeContext.(*http.Request)
+	if ok {
+		state, ok = request.Context().Value(sessionStateKey{}).(*sessionState)
+	}
+	if !ok {
+		panic(fmt.Sprintf("Attempt to access %s outside of a request with a session.", key))
+	}
+
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	if state.id != "" && !state.checked {
+		state.checked = this.config.Store.Exists(state.id)
+		if !state.checked {
+			state.id = ""
+		}
+	}
+	if state.id == "" {
+		id := make([]byte, 16)
+		rand.Read(id)
+		state.id = hex.EncodeToString(id)
+		state.checked = true
+		http.SetCookie(state.writer, &http.Cookie{
+			Name:     this.config.CookieName,
+			Value:    state.id + "." + this.sign(state.id),
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   request.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	return state.id
+}
+
+func (this *sessionScope) Scope(key inject.Key, provider inject.Provider) inject.Provider {
+	return func(context inject.Context, container inject.Container) interface{} {
+		id := this.session(key, context)
+		if value, exists := this.config.Store.Get(id, key); exists {
+			return value
+		}
+		value := provider(context, container)
+		stored, isValue := this.config.Store.Put(id, key, value)
+		if !isValue {
+			// Another request of the session provided the key first.
+			dispose(value)
+		}
+		return stored
+	}
+}
+
+// Wraps a handler to track the session of each request.
+type sessionHandler struct {
+	sessions *sessionScope
+	handler  http.Handler
+}
+
+func (this sessionHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	request = this.sessions.enter(writer, request)
+	// Request-scoped providers are passed the request holding the session.
+	seedRequestScope(writer, request)
+	this.handler.ServeHTTP(writer, request)
+}
+
+// Closes a session value if it is an io.Closer.
+func dispose(value interface{}) {
+	if closer, ok := value.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Printf("Unable to close session value %T: %v", value, err)
+		}
+	}
+}
+
+type memorySession struct {
+	values   map[inject.Key]interface{}
+	lastUsed time.Time
+}
+
+/*
+	A SessionStore that holds sessions in memory, expiring sessions that have not been used for the
+	idle timeout. Expired sessions are deleted when they are next used, and all expired sessions are
+	deleted by Sweep, which the store calls at most once per idle timeout as it is used.
+
+	A store created by NewMemorySessionStore runs no goroutine, so the values of an expired session
+	are only closed by a later call to the store or to Sweep. A store created by
+	NewMemorySessionStoreWithSweeper also sweeps in the background, closing them promptly, until
+	the store is closed.
+*/
+type MemorySessionStore struct {
+	idleTimeout time.Duration
+
+	lock      sync.Mutex
+	sessions  map[string]*memorySession
+	lastSweep time.Time
+
+	// Closed to stop the background sweeper, or nil if the store has none.
+	stop     chan struct{}
+	stopping sync.Once
+}
+
+// Creates a MemorySessionStore expiring sessions after the idle timeout.
+func NewMemorySessionStore(idleTimeout time.Duration) *MemorySessionStore {
+	return &MemorySessionStore{
+		idleTimeout: idleTimeout,
+		sessions:    make(map[string]*memorySession),
+		lastSweep:   time.Now(),
+	}
+}
+
+/*
+	Creates a MemorySessionStore expiring sessions after the idle timeout, which sweeps the expired
+	sessions every interval in the background until it is closed.
+*/
+func NewMemorySessionStoreWithSweeper(idleTimeout time.Duration, interval time.Duration) *MemorySessionStore {
+	store := NewMemorySessionStore(idleTimeout)
+	store.stop = make(chan struct{})
+	go store.sweep(interval)
+	return store
+}
+
+// Sweeps the store every interval until it is closed.
+func (this *MemorySessionStore) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			this.Sweep()
+		case <-this.stop:
+			return
+		}
+	}
+}
+
+/*
+	Stops the background sweeper, if any. The store may still be used, expiring sessions as it is
+	used or swept.
+*/
+func (this *MemorySessionStore) Close() error {
+	if this.stop != nil {
+		this.stopping.Do(func() {
+			close(this.stop)
+		})
+	}
+	return nil
+}
+
+/*
+	Removes the expired sessions, returning their values to be disposed. Sweeps all sessions if
+	sweep is set, and otherwise only the session with the ID. The lock must be held.
+*/
+func (this *MemorySessionStore) expire(now time.Time, id string, sweep bool) []interface{} {
+	var expired []interface{}
+	remove := func(id string, session *memorySession) {
+		if now.Sub(session.lastUsed) >= this.idleTimeout {
+			for _, value := range session.values {
+				expired = append(expired, value)
+			}
+			delete(this.sessions, id)
+		}
+	}
+	if sweep {
+		for id, session := range this.sessions {
+			remove(id, session)
+		}
+		this.lastSweep = now
+	} else if session, exists := this.sessions[id]; exists {
+		remove(id, session)
+	}
+	return expired
+}
+
+// Returns the session with the ID, if it has not expired, marking it used.
+func (this *MemorySessionStore) use(id string, create bool) (*memorySession, bool) {
+	this.lock.Lock()
+	now := time.Now()
+	expired := this.expire(now, id, now.Sub(this.lastSweep) >= this.idleTimeout)
+	session, exists := this.sessions[id]
+	if !exists && create {
+		session = &memorySession{values: make(map[inject.Key]interface{})}
+		this.sessions[id] = session
+		exists = true
+	}
+	if exists {
+		session.lastUsed = now
+	}
+	this.lock.Unlock()
+
+	for _, value := range expired {
+		dispose(value)
+	}
+	return session, exists
+}
+
+func (this *MemorySessionStore) Exists(id string) bool {
+	_, exists := this.use(id, false)
+	return exists
+}
+
+func (this *MemorySessionStore) Get(id string, key inject.Key) (interface{}, bool) {
+	session, exists := this.use(id, false)
+	if !exists {
+		return nil, false
+	}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	value, exists := session.values[key]
+	return value, exists
+}
+
+func (this *MemorySessionStore) Put(id string, key inject.Key, value interface{}) (interface{}, bool) {
+	session, _ := this.use(id, true)
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if stored, exists := session.values[key]; exists {
+		return stored, false
+	}
+	session.values[key] = value
+	return value, true
+}
+
+func (this *MemorySessionStore) Delete(id string) {
+	this.lock.Lock()
+	session, exists := this.sessions[id]
+	delete(this.sessions, id)
+	this.lock.Unlock()
+	if exists {
+		for _, value := range session.values {
+			dispose(value)
+		}
+	}
+}
+
+// Deletes every expired session, closing its values.
+func (this *MemorySessionStore) Sweep() {
+	this.lock.Lock()
+	expired := this.expire(time.Now(), "", true)
+	this.lock.Unlock()
+	for _, value := range expired {
+		dispose(value)
+	}
+}
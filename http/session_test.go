@@ -0,0 +1,182 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http_test
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/http"
+	"code.google.com/p/go-inject/http/httptest"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type Cart struct {
+	id     int
+	closed atomic.Bool
+}
+
+func (this *Cart) Close() error {
+	this.closed.Store(true)
+	return nil
+}
+
+// Returns an injector serving the ID of the session-scoped Cart, and the carts it provides.
+func sessionInjector(store inject_http.SessionStore) (inject.Injector, *[]*Cart) {
+	injector := inject.CreateInjector()
+	inject_http.ConfigureScopes(injector)
+	inject_http.ConfigureInjector(injector)
+	inject_http.ConfigureSessions(injector, inject_http.SessionConfig{Secret: []byte("secret"), Store: store})
+	var carts []*Cart
+	injector.BindInScope(Cart{}, func(_ inject.Context, _ inject.Container) interface{} {
+		carts = append(carts, &Cart{id: len(carts) + 1})
+		return carts[len(carts)-1]
+	}, inject_http.SessionScoped{})
+	inject_http.BindHandlerFunc(injector, "/cart", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, injector.CreateContainer().GetInstance(r, Cart{}).(*Cart).id)
+	})
+	return injector, &carts
+}
+
+// Requests the cart with the cookie, if any, returning the cart ID and the session cookie.
+func getCart(harness *inject_httptest.Harness, cookie *http.Cookie) (string, *http.Cookie) {
+	request := httptest.NewRequest("GET", "http://localhost/cart", nil)
+	if cookie != nil {
+		request.AddCookie(cookie)
+	}
+	response := harness.Do(request)
+	for _, set := range response.Result().Cookies() {
+		cookie = set
+	}
+	return response.Body.String(), cookie
+}
+
+func TestSessionScopedValuesAreReusedWithinASession(t *testing.T) {
+	injector, _ := sessionInjector(inject_http.NewMemorySessionStore(time.Hour))
+	harness := inject_httptest.New(injector)
+
+	first, cookie := getCart(harness, nil)
+	if cookie == nil {
+		t.Fatal("Expected a session cookie")
+	}
+	if again, _ := getCart(harness, cookie); again != first {
+		t.Errorf("Expected cart %s within the session, got %s", first, again)
+	}
+	if other, _ := getCart(harness, nil); other == first {
+		t.Error("Expected a new cart for a new session")
+	}
+
+	forged := &http.Cookie{Name: cookie.Name, Value: cookie.Value + "x"}
+	if forgedCart, _ := getCart(harness, forged); forgedCart == first {
+		t.Error("Expected a new cart for a forged cookie")
+	}
+}
+
+type sessionContextValue struct{}
+
+func TestSessionsFollowRequestsDerivedWithContext(t *testing.T) {
+	injector, _ := sessionInjector(inject_http.NewMemorySessionStore(time.Hour))
+	inject_http.BindMiddleware(injector, 0, func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			handler.ServeHTTP(writer, request.WithContext(context.WithValue(request.Context(), sessionContextValue{}, true)))
+		})
+	})
+	harness := inject_httptest.New(injector)
+
+	first, cookie := getCart(harness, nil)
+	if cookie == nil {
+		t.Fatal("Expected a session cookie")
+	}
+	if again, _ := getCart(harness, cookie); again != first {
+		t.Errorf("Expected cart %s within the session, got %s", first, again)
+	}
+}
+
+func TestExpiredSessionValuesAreClosed(t *testing.T) {
+	store := inject_http.NewMemorySessionStore(10 * time.Millisecond)
+	injector, carts := sessionInjector(store)
+	harness := inject_httptest.New(injector)
+
+	first, cookie := getCart(harness, nil)
+	time.Sleep(20 * time.Millisecond)
+	store.Sweep()
+	if !(*carts)[0].closed.Load() {
+		t.Error("Expected the expired session's cart to be closed")
+	}
+	if again, _ := getCart(harness, cookie); again == first {
+		t.Error("Expected a new cart after the session expired")
+	}
+}
+
+func TestSweeperClosesExpiredSessionValues(t *testing.T) {
+	store := inject_http.NewMemorySessionStoreWithSweeper(10*time.Millisecond, 5*time.Millisecond)
+	defer store.Close()
+	injector, carts := sessionInjector(store)
+
+	getCart(inject_httptest.New(injector), nil)
+	cart := (*carts)[0]
+	for deadline := time.Now().Add(5 * time.Second); !cart.closed.Load(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the sweeper to close the expired session's cart")
+		}
+	}
+}
+
+type Visit struct{}
+
+func TestConcurrentLookupsShareTheRequestsSession(t *testing.T) {
+	injector := inject.CreateInjector()
+	inject_http.ConfigureScopes(injector)
+	inject_http.ConfigureInjector(injector)
+	inject_http.ConfigureSessions(injector, inject_http.SessionConfig{Secret: []byte("secret")})
+	var visits atomic.Int32
+	injector.BindInScope(Visit{}, func(_ inject.Context, _ inject.Container) interface{} {
+		return visits.Add(1)
+	}, inject_http.SessionScoped{})
+	inject_http.BindHandlerFunc(injector, "/visit", func(w http.ResponseWriter, r *http.Request) {
+		results := make(chan interface{}, 10)
+		for i := 0; i < cap(results); i++ {
+			go func() {
+				results <- injector.CreateContainer().GetInstance(r, Visit{})
+			}()
+		}
+		first := <-results
+		for i := 1; i < cap(results); i++ {
+			if visit := <-results; visit != first {
+				t.Errorf("Expected every lookup to share visit %v, got %v", first, visit)
+			}
+		}
+	})
+
+	response := inject_httptest.New(injector).Get("/visit")
+	if cookies := response.Result().Cookies(); len(cookies) != 1 {
+		t.Errorf("Expected a single session cookie, got %v", cookies)
+	}
+}
+
+func TestSessionScopedOutsideOfRequestPanics(t *testing.T) {
+	injector, _ := sessionInjector(inject_http.NewMemorySessionStore(time.Hour))
+	defer func() {
+		recover() // Expected
+	}()
+	injector.CreateContainer().GetInstance(nil, Cart{})
+	t.Error("Expected a panic when looking up a session-scoped value outside of a request")
+}
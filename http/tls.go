@@ -0,0 +1,262 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/multi"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// A source of the certificate the server presents during the TLS handshake.
+type CertificateSource interface {
+	GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error)
+}
+
+// Container key for the certificate bound with one of the BindCertificate functions.
+type certificateKey struct{}
+
+// Returns the optional binding of the certificate source.
+func certificates(injector inject.Injector) inject_multi.OptionalOf[CertificateSource] {
+	return inject_multi.EnsureOptionalOfBound[CertificateSource](injector, certificateKey{})
+}
+
+// Returns the bound certificate source, if any.
+func boundCertificate(container inject.Container) (CertificateSource, bool) {
+	return inject_multi.GetOptional[CertificateSource](nil, container, certificateKey{})
+}
+
+// Returns a TLS configuration that presents the certificate from source.
+func NewTLSConfig(source CertificateSource) *tls.Config {
+	return &tls.Config{GetCertificate: source.GetCertificate}
+}
+
+// A CertificateSource that always presents the same certificate.
+type staticCertificate struct {
+	certificate *tls.Certificate
+}
+
+func (this staticCertificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return this.certificate, nil
+}
+
+/*
+	Binds the certificate the server presents, so that it serves HTTPS. Binding more than one
+	certificate panics, naming both callers.
+*/
+func BindCertificate(injector inject.Injector, certificate tls.Certificate) {
+	certificates(injector).BindInstance(staticCertificate{&certificate})
+}
+
+/*
+	Binds the certificate and key in the PEM files as the certificate the server presents. The
+	files are read when the server is created. See BindCertificate.
+*/
+func BindCertificateFiles(injector inject.Injector, certFile string, keyFile string) {
+	certificates(injector).Bind(func(_ inject.Context, _ inject.Container) CertificateSource {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			panic(fmt.Sprintf("Unable to load the certificate in %s and %s: %v", certFile, keyFile, err))
+		}
+		return staticCertificate{&certificate}
+	})
+}
+
+/*
+	Binds the certificate and key in the PEM files as the certificate the server presents, reading
+	them again when they change, checking every DefaultCertificateCheckInterval. See
+	ReloadingCertificate and BindCertificate.
+*/
+func BindReloadingCertificateFiles(injector inject.Injector, certFile string, keyFile string) {
+	certificates(injector).Bind(func(_ inject.Context, _ inject.Container) CertificateSource {
+		certificate, err := NewReloadingCertificate(certFile, keyFile)
+		if err != nil {
+			panic(err.Error())
+		}
+		return certificate
+	})
+}
+
+// How often a ReloadingCertificate checks whether its files were modified, by default.
+const DefaultCertificateCheckInterval = 10 * time.Second
+
+/*
+	A CertificateSource that reads a certificate and key from PEM files, and reads them again when
+	either file is modified. The files are checked during a handshake at most once per check
+	interval. If a modified pair cannot be loaded (for example, because only one of the files has
+	been replaced so far), the previous certificate is presented until it can be, and the failure
+	is logged once until a reload succeeds.
+*/
+type ReloadingCertificate struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	lock        sync.Mutex
+	certificate *tls.Certificate
+	modified    time.Time
+	checked     time.Time
+	failing     bool
+}
+
+/*
+	Creates a ReloadingCertificate checking the files every DefaultCertificateCheckInterval,
+	returning an error if the files cannot be loaded.
+*/
+func NewReloadingCertificate(certFile string, keyFile string) (*ReloadingCertificate, error) {
+	return NewReloadingCertificateWithInterval(certFile, keyFile, DefaultCertificateCheckInterval)
+}
+
+/*
+	Creates a ReloadingCertificate checking the files at most once per interval, returning an error
+	if the files cannot be loaded.
+*/
+func NewReloadingCertificateWithInterval(certFile string, keyFile string, interval time.Duration) (*ReloadingCertificate, error) {
+	this := &ReloadingCertificate{certFile: certFile, keyFile: keyFile, interval: interval}
+	if err := this.reload(); err != nil {
+		return nil, err
+	}
+	this.checked = time.Now()
+	return this, nil
+}
+
+// Returns the latest modification time of the files.
+func (this *ReloadingCertificate) lastModified() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{this.certFile, this.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// Loads the files if they have changed. The lock must be held.
+func (this *ReloadingCertificate) reload() error {
+	modified, err := this.lastModified()
+	if err != nil {
+		return fmt.Errorf("inject_http: unable to read the certificate in %s and %s: %w", this.certFile, this.keyFile, err)
+	}
+	if this.certificate != nil && modified.Equal(this.modified) {
+		return nil
+	}
+	certificate, err := tls.LoadX509KeyPair(this.certFile, this.keyFile)
+	if err != nil {
+		return fmt.Errorf("inject_http: unable to load the certificate in %s and %s: %w", this.certFile, this.keyFile, err)
+	}
+	this.certificate = &certificate
+	this.modified = modified
+	return nil
+}
+
+func (this *ReloadingCertificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if now := time.Now(); now.Sub(this.checked) >= this.interval {
+		this.checked = now
+		if err := this.reload(); err != nil {
+			if !this.failing {
+				log.Printf("Presenting the previous certificate until the files can be loaded: %v", err)
+			}
+			this.failing = true
+		} else {
+			this.failing = false
+		}
+	}
+	return this.certificate, nil
+}
+
+/*
+	Generates a self-signed certificate and key for the hosts, encoded as PEM. Hosts may be DNS
+	names or IP addresses; if none are given, the certificate is for localhost and 127.0.0.1. This
+	is intended for tests.
+*/
+func GenerateSelfSignedPEM(hosts ...string) (certPEM []byte, keyPEM []byte, err error) {
+	if len(hosts) == 0 {
+		hosts = []string{"localhost", "127.0.0.1"}
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hosts[0]},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		nil
+}
+
+/*
+	Generates a self-signed certificate for the hosts. See GenerateSelfSignedPEM. The certificate's
+	Leaf is set, so clients can trust it by adding it to an x509.CertPool.
+*/
+func GenerateSelfSignedCertificate(hosts ...string) (tls.Certificate, error) {
+	certPEM, keyPEM, err := GenerateSelfSignedPEM(hosts...)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	certificate.Leaf, err = x509.ParseCertificate(certificate.Certificate[0])
+	return certificate, err
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_http_test
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/http"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Returns a client that trusts only the certificate.
+func trusting(certificate tls.Certificate) *http.Client {
+	pool := x509.NewCertPool()
+	pool.AddCert(certificate.Leaf)
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+}
+
+func TestBoundCertificateServesHTTPS(t *testing.T) {
+	certificate, err := inject_http.GenerateSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	injector := inject.CreateInjector()
+	inject_http.ConfigureScopes(injector)
+	inject_http.ConfigureInjector(injector)
+	inject_http.BindListener(injector, listener)
+	inject_http.BindCertificate(injector, certificate)
+	inject_http.BindHandlerFunc(injector, "/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.TLS != nil)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- inject_http.Run(ctx, injector)
+	}()
+	response, err := trusting(certificate).Get("https://" + listener.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if string(body) != "true" {
+		t.Errorf("Expected the request to use TLS, got %q", body)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Expected the server to shut down cleanly, got %v", err)
+	}
+}
+
+func TestBindingTwoCertificatesPanics(t *testing.T) {
+	certificate, err := inject_http.GenerateSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	injector := inject.CreateInjector()
+	inject_http.BindCertificate(injector, certificate)
+	defer func() {
+		recover() // Expected
+	}()
+	inject_http.BindCertificateFiles(injector, "cert.pem", "key.pem")
+	t.Error("Expected a panic when binding a second certificate")
+}
+
+// Writes a new self-signed certificate to the files, modified at the time.
+func writeCertificate(t *testing.T, certFile string, keyFile string, modified time.Time) {
+	certPEM, keyPEM, err := inject_http.GenerateSelfSignedPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for file, contents := range map[string][]byte{certFile: certPEM, keyFile: keyPEM} {
+		if err := os.WriteFile(file, contents, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReloadingCertificateRereadsChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Minute)
+	writeCertificate(t, certFile, keyFile, start)
+
+	source, err := inject_http.NewReloadingCertificateWithInterval(certFile, keyFile, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := source.GetCertificate(nil)
+	if unchanged, _ := source.GetCertificate(nil); unchanged != first {
+		t.Error("Expected the same certificate while the files are unchanged")
+	}
+
+	writeCertificate(t, certFile, keyFile, start.Add(time.Second))
+	second, _ := source.GetCertificate(nil)
+	if second == first {
+		t.Error("Expected a new certificate after the files changed")
+	}
+
+	// A half-written pair keeps the previous certificate.
+	os.WriteFile(keyFile, []byte("not a key"), 0600)
+	os.Chtimes(keyFile, start.Add(2*time.Second), start.Add(2*time.Second))
+	if current, _ := source.GetCertificate(nil); current != second {
+		t.Error("Expected the previous certificate while the files cannot be loaded")
+	}
+}
+
+func TestReloadingCertificateChecksFilesOncePerInterval(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Minute)
+	writeCertificate(t, certFile, keyFile, start)
+
+	source, err := inject_http.NewReloadingCertificateWithInterval(certFile, keyFile, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := source.GetCertificate(nil)
+	writeCertificate(t, certFile, keyFile, start.Add(time.Second))
+	if current, _ := source.GetCertificate(nil); current != first {
+		t.Error("Expected the files not to be checked again within the interval")
+	}
+}
+
+func TestBoundCertificateAppliesToDeclaredServers(t *testing.T) {
+	certificate, err := inject_http.GenerateSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	injector := inject.CreateInjector()
+	inject_http.ConfigureScopes(injector)
+	inject_http.DeclareServer(injector, Public{}, inject_http.ServerConfig{Addr: "127.0.0.1:0"})
+	inject_http.BindCertificate(injector, certificate)
+	inject_http.BindServerHandlerFunc(injector, Public{}, "/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.TLS != nil)
+	})
+
+	addr := inject_http.ServerAddr(injector, Public{}).String()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- inject_http.RunServers(ctx, injector)
+	}()
+	response, err := trusting(certificate).Get("https://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if string(body) != "true" {
+		t.Errorf("Expected the request to use TLS, got %q", body)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Expected the server to shut down cleanly, got %v", err)
+	}
+}
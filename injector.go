@@ -17,8 +17,11 @@
 package inject
 
 import (
+	"context"
 	"fmt"
 	"reflect"
+	"strings"
+	"sync"
 )
 
 // Context that is passed to scopes.
@@ -131,6 +134,15 @@ type keyset map[Key]Key
 type binding struct {
 	injector *injector
 	provider Provider
+
+	// The tag of the scope caching the provided values, or nil if unscoped.
+	scope Tag
+
+	// Where the binding was made. See callerSource().
+	source string
+
+	// The key in the child injector, if the binding was exposed from a child injector.
+	exposedFrom Key
 }
 
 // Bindings for each key in the injector.
@@ -150,33 +162,64 @@ type injector struct {
 
 	// A pointer to the keyset for this injector and all ancestor and descendant injectors.
 	keyset
+
+	// The child injectors created from this injector. See Describe().
+	children []*injector
+
+	// The dependencies provisioned through this injector and all ancestor and descendant injectors.
+	dependencies *dependencies
+
+	// The shutdown hooks of this injector and all ancestor and descendant injectors. See OnShutdown().
+	shutdown *shutdownHooks
+
+	/*
+		The injector itself. Methods with value receivers, like Bind(), see a copy of the injector,
+		so this identifies the injector created by CreateInjector() or CreateChildInjector().
+	*/
+	self *injector
 }
 
 func CreateInjector() Injector {
-	singleton := singletonscope{make(map[Key]interface{})}
+	singleton := singletonscope{
+		values:    make(map[Key]interface{}),
+		providing: make(map[Key]*provision),
+		waiting:   make(map[*[]InjectionPoint]*provision),
+	}
 	scopes := make(scopes)
 	scopes[Singleton{}] = &singleton
-	return &injector{
-		bindings: make(map[Key]binding),
-		scopes:   scopes,
-		parent:   nil,
-		keyset:   make(keyset),
+	root := &injector{
+		bindings:     make(map[Key]binding),
+		scopes:       scopes,
+		parent:       nil,
+		keyset:       make(keyset),
+		dependencies: &dependencies{edges: make(map[dependency]bool)},
+		shutdown:     &shutdownHooks{},
 	}
+	root.self = root
+	return root
 }
 
 // Creates a child injector that can contain bindings not available to the parent injector.
 func (this *injector) CreateChildInjector() Injector {
 	child := injector{
-		bindings: make(map[Key]binding),
-		scopes:   this.scopes,
-		parent:   this,
-		keyset:   this.keyset,
+		bindings:     make(map[Key]binding),
+		scopes:       this.scopes,
+		parent:       this,
+		keyset:       this.keyset,
+		dependencies: this.dependencies,
+		shutdown:     this.shutdown,
 	}
+	child.self = &child
+	this.children = append(this.children, &child)
 
 	return &child
 }
 
 func (this injector) Bind(key Key, provider Provider) {
+	this.bind(key, provider, nil)
+}
+
+func (this injector) bind(key Key, provider Provider, scopeTag Tag) {
 	if _, exists := this.bindings[key]; exists {
 		panic(fmt.Sprintf("%s is already bound.", key))
 	}
@@ -186,19 +229,36 @@ func (this injector) Bind(key Key, provider Provider) {
 	}
 
 	this.keyset[key] = key
-	this.bindings[key] = binding{&this, provider}
+	this.bindings[key] = binding{&this, provider, scopeTag, callerSource(), nil}
+}
+
+/*
+	The key under which scopes cache the values of a key bound in a child injector. Scopes are shared
+	by every injector, so the same key bound in sibling child injectors must not share a cache slot.
+	Keys bound in the root injector are cached as is, so only they may be seeded in a SeedableScope.
+*/
+type OwnedKey struct {
+	Owner Injector
+	Key   Key
+}
+
+func (this OwnedKey) String() string {
+	return fmt.Sprintf("%s@%p", FormatKey(this.Key), this.Owner)
 }
 
 func (this injector) Scope(key Key, provider Provider, scopeTag Tag) Provider {
 	var scopes = this.scopes
 	if scope, exists := scopes[scopeTag]; exists {
+		if this.parent != nil {
+			key = OwnedKey{this.self, key}
+		}
 		return scope.Scope(key, provider)
 	}
 	panic(fmt.Sprintf("Scope tag '%s' is not bound", scopeTag))
 }
 
 func (this injector) BindInScope(key Key, provider Provider, scopeTag Tag) {
-	this.Bind(key, this.Scope(key, provider, scopeTag))
+	this.bind(key, this.Scope(key, provider, scopeTag), scopeTag)
 }
 
 func (this injector) BindInstance(key Key, instance interface{}) {
@@ -233,6 +293,8 @@ func (this injector) CreateContainer() Container {
 		make(keyset),
 		nil,
 		make(map[*injector]*container),
+		new([]InjectionPoint),
+		new(bool),
 	}
 }
 
@@ -271,7 +333,9 @@ func (this injector) ExposeAndRename(childKey Key, parentKey Key) {
 		panic(fmt.Sprintf("A binding for %s already exists. It could come from another child injector or an ancestor injector.", parentKey))
 	}
 
-	this.parent.bindings[parentKey] = this.bindings[childKey]
+	exposed := this.bindings[childKey]
+	exposed.exposedFrom = childKey
+	this.parent.bindings[parentKey] = exposed
 }
 
 func (this injector) getBinding(key Key) (binding, bool) {
@@ -340,6 +404,46 @@ type Container interface {
 	GetTaggedProvider(Key, Tag) Provider
 }
 
+/*
+	A Container that can tell a Provider where it is providing a value. The Containers created by an
+	Injector, and passed to Providers, implement it; a Provider type-asserts its Container:
+
+	  if points, ok := container.(inject.InjectionPointContainer); ok {
+	    key := points.CurrentKey()
+	  }
+*/
+type InjectionPointContainer interface {
+	Container
+
+	/*
+		Returns the key whose Provider is running, so a Provider can tell which key it is providing,
+		or nil if no Provider is running.
+	*/
+	CurrentKey() Key
+
+	// Returns where the running Provider is providing a value, or a zero InjectionPoint if none is.
+	InjectionPoint() InjectionPoint
+}
+
+/*
+	Describes where a Provider is providing a value, so that a Provider can create a value for a
+	particular consumer, like a logger or metric named after it. See
+	InjectionPointContainer.InjectionPoint().
+*/
+type InjectionPoint struct {
+	// The key being provided.
+	Key Key
+
+	// The key whose Provider looked up Key, or nil if Key was looked up outside of any Provider.
+	Parent Key
+
+	// The injector holding the binding of Key.
+	Injector Injector
+
+	// The tag of the scope of the binding of Key, or nil if it is unscoped.
+	Scope Tag
+}
+
 type container struct {
 	// The injector holding the bindings available to the container.
 	injector *injector
@@ -352,6 +456,12 @@ type container struct {
 
 	// Child container for each injector
 	children map[*injector]*container
+
+	// The keys being provided, shared with the parent container. The last key is being provided now.
+	provisioning *[]InjectionPoint
+
+	// Whether failures panic with a *ProvisionError, shared with the parent container. See TryGetInstance().
+	describingFailures *bool
 }
 
 func createChildProvider(parent *container, binding binding) Provider {
@@ -365,6 +475,8 @@ func createChildProvider(parent *container, binding binding) Provider {
 			make(keyset),
 			parent,
 			parent.children,
+			parent.provisioning,
+			parent.describingFailures,
 		}
 		childContainer = &container
 		parent.children[binding.injector] = childContainer
@@ -383,31 +495,163 @@ func (this container) GetProvider(key Key) Provider {
 
 	this.keyset[key] = key
 
+	if provisioning := *this.provisioning; len(provisioning) > 0 && this.injector.dependencies.enabled.Load() {
+		this.injector.dependencies.add(provisioning[len(provisioning)-1].Key, key)
+	}
+
 	if binding, ok := this.injector.bindings[key]; ok {
 		if binding.injector == this.injector {
-			return binding.provider
+			return this.tracking(key, binding, binding.provider)
 		} else {
-			return createChildProvider(&this, binding)
+			return this.tracking(key, binding, createChildProvider(&this, binding))
 		}
 	}
 
 	if binding, ok := this.injector.findAncestorBinding(key); ok {
-		return createChildProvider(&this, binding)
+		return this.tracking(key, binding, createChildProvider(&this, binding))
 	}
 
 	panic(fmt.Sprintf("Unable to find %s in injector", key))
 }
 
+/*
+	Wraps the provider of the key's binding so that, while it runs, the key is the current injection
+	point and the keys it looks up are recorded as dependencies of the key.
+*/
+func (this container) tracking(key Key, binding binding, provider Provider) Provider {
+	return func(context Context, container Container) interface{} {
+		point := InjectionPoint{key, this.CurrentKey(), binding.injector.self, binding.scope}
+		*this.provisioning = append(*this.provisioning, point)
+		defer func() {
+			*this.provisioning = (*this.provisioning)[:len(*this.provisioning)-1]
+		}()
+		return provider(context, container)
+	}
+}
+
+func (this container) CurrentKey() Key {
+	return this.InjectionPoint().Key
+}
+
+func (this container) InjectionPoint() InjectionPoint {
+	if provisioning := *this.provisioning; len(provisioning) > 0 {
+		return provisioning[len(provisioning)-1]
+	}
+	return InjectionPoint{}
+}
+
 // Returns a Provider that can create an instance of the instanceType tagged with tag.
 func (this container) GetTaggedProvider(instanceType Key, tag Tag) Provider {
 	return this.GetProvider(TaggedKey{instanceType, tag})
 }
 
+/*
+	The error TryGetInstance() returns when an instance cannot be provided. The Chain holds the keys
+	that were being provided when the failure occurred, starting with the key that was requested
+	and ending with the key whose lookup or Provider failed. Cause holds the original panic value.
+	Sources holds where each key in the Chain was bound, or "" for a key that is not bound.
+*/
+type ProvisionError struct {
+	Chain   []Key
+	Cause   interface{}
+	Sources []string
+}
+
+func (this *ProvisionError) Error() string {
+	chain := make([]string, len(this.Chain))
+	for i, key := range this.Chain {
+		chain[i] = FormatKey(key)
+	}
+	return fmt.Sprintf("Unable to provide %s: %v", strings.Join(chain, " -> "), this.Cause)
+}
+
+// Key in a context.Context for whether lookups made with it describe failures. See DescribeFailures().
+type describingFailuresKey struct{}
+
+/*
+	Returns a copy of parent under which Container.GetInstance() panics with a *ProvisionError, as
+	TryGetInstance() returns, rather than with the original value. This applies to lookups whose
+	Context is the returned context, or whose Context() is, like an *http.Request derived from it.
+*/
+func DescribeFailures(parent context.Context) context.Context {
+	return context.WithValue(parent, describingFailuresKey{}, true)
+}
+
+// Returns whether lookups made with the Context describe failures. See DescribeFailures().
+func describesFailures(lookup Context) bool {
+	var values context.Context
+	switch lookup := lookup.(type) {
+	case interface{ Context() context.Context }:
+		values = lookup.Context()
+	case context.Context:
+		values = lookup
+	default:
+		return false
+	}
+	return values.Value(describingFailuresKey{}) != nil
+}
+
 // Returns an instance of the type bound to the key.
 func (this container) GetInstance(context Context, key Key) interface{} {
+	if *this.describingFailures || describesFailures(context) {
+		defer func() {
+			if cause := recover(); cause != nil {
+				if err, ok := cause.(*ProvisionError); ok {
+					err.Chain = append([]Key{key}, err.Chain...)
+					err.Sources = append([]string{this.source(key)}, err.Sources...)
+					panic(err)
+				}
+				panic(&ProvisionError{[]Key{key}, cause, []string{this.source(key)}})
+			}
+		}()
+	}
 	return this.GetProvider(key)(context, this)
 }
 
+/*
+	Returns an instance of the type bound to the key like Container.GetInstance(), but returns a
+	*ProvisionError rather than panicking if the instance cannot be provided. Lookups made by the
+	Providers it runs are described in the error's Chain; Container.GetInstance() itself panics with
+	the original value. The Chain holds only the key for a Container not created by an Injector.
+*/
+func TryGetInstance(from Container, context Context, key Key) (value interface{}, err error) {
+	defer func() {
+		if cause := recover(); cause != nil {
+			if provisionErr, ok := cause.(*ProvisionError); ok {
+				err = provisionErr
+			} else {
+				err = &ProvisionError{[]Key{key}, cause, []string{""}}
+			}
+		}
+	}()
+	var describingFailures *bool
+	switch describing := from.(type) {
+	case container:
+		describingFailures = describing.describingFailures
+	case *container:
+		describingFailures = describing.describingFailures
+	}
+	if describingFailures != nil {
+		previous := *describingFailures
+		*describingFailures = true
+		defer func() {
+			*describingFailures = previous
+		}()
+	}
+	return from.GetInstance(context, key), nil
+}
+
+// Returns where the key was bound, or "" if it is not bound.
+func (this container) source(key Key) string {
+	if binding, ok := this.injector.bindings[key]; ok {
+		return binding.source
+	}
+	if binding, ok := this.injector.findAncestorBinding(key); ok {
+		return binding.source
+	}
+	return ""
+}
+
 // Returns an instance of the instanceType tagged with tag.
 func (this container) GetTaggedInstance(context Context, instanceType Key, tag Tag) interface{} {
 	return this.GetInstance(context, TaggedKey{instanceType, tag})
@@ -420,8 +664,14 @@ func (this TaggedKey) String() string {
 	return fmt.Sprintf("%v<%s(%v)>", reflect.TypeOf(this.Key), reflect.TypeOf(this.Tag), this.Tag)
 }
 
+/*
+	A scope holding values for each context it is in. Contexts may be entered, used and exited
+	concurrently, as when serving concurrent requests.
+*/
 type simplescope struct {
-	name   string
+	name string
+
+	lock   sync.Mutex
 	values map[Context]map[Key]interface{}
 }
 
@@ -440,31 +690,80 @@ type SimpleScope interface {
 	Exit(Context)
 }
 
+/*
+	A SimpleScope whose values may be set for an entered context, rather than provided. The scopes
+	created by CreateSimpleScope() are seedable.
+*/
+type SeedableScope interface {
+	SimpleScope
+
+	// Sets the value of a key in the scope for an entered context, so it is not provided.
+	Seed(Context, Key, interface{})
+}
+
 func (this *simplescope) Enter(context Context) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
 	this.values[context] = make(map[Key]interface{})
 }
 
 func (this *simplescope) Exit(context Context) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
 	if _, exists := this.values[context]; exists {
 		delete(this.values, context)
 	} else {
-		panic(fmt.Sprintf("Already out of context when existing scope %v", this))
+		panic(fmt.Sprintf("Already out of context when existing scope %v", this.name))
 	}
 }
 
-func (this *simplescope) Scope(key Key, provider Provider) Provider {
-	return func(context Context, container Container) interface{} {
-		if scope, exists := this.values[context]; exists {
-			if value, exists := scope[key]; exists {
-				return value
-			}
+func (this *simplescope) Seed(context Context, key Key, value interface{}) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if scope, exists := this.values[context]; exists {
+		scope[key] = value
+	} else {
+		panic(fmt.Sprintf("Attempt to seed %s outside of scope %s.", key, this.name))
+	}
+}
 
-			value := provider(context, container)
-			scope[key] = value
+/*
+	Returns the value of the key cached for the context, if any. Panics if the context is not in the
+	scope.
+*/
+func (this *simplescope) cached(context Context, key Key) (interface{}, bool) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if scope, exists := this.values[context]; exists {
+		value, exists := scope[key]
+		return value, exists
+	}
+	panic(fmt.Sprintf("Attempt to access %s outside of scope %s. %d scopes are active.", key, this.name, len(this.values)))
+}
 
+/*
+	Caches the value of the key for the context and returns it or, if the key was cached for the
+	context while the value was being provided, returns the value cached first.
+*/
+func (this *simplescope) cache(context Context, key Key, value interface{}) interface{} {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if scope, exists := this.values[context]; exists {
+		if cached, exists := scope[key]; exists {
+			return cached
+		}
+		scope[key] = value
+	}
+	return value
+}
+
+func (this *simplescope) Scope(key Key, provider Provider) Provider {
+	return func(context Context, container Container) interface{} {
+		if value, exists := this.cached(context, key); exists {
 			return value
 		}
-		panic(fmt.Sprintf("Attempt to access %s outside of scope %s. %d scopes are active.", key, this.name, len(this.values)))
+		// The lock is not held while providing, as the provider may look up other scoped keys.
+		return this.cache(context, key, provider(context, container))
 	}
 }
 
@@ -486,7 +785,18 @@ func (this injector) BindScope(scope Scope, scopeTag Tag) {
 }
 
 type singletonscope struct {
+	lock   sync.Mutex
 	values map[Key]interface{}
+
+	// The keys being provided, and the key each container is waiting for another container to provide.
+	providing map[Key]*provision
+	waiting   map[*[]InjectionPoint]*provision
+}
+
+// A key being provided by a container, identified by the keys it is providing.
+type provision struct {
+	by   *[]InjectionPoint
+	done chan struct{}
 }
 
 func (this *singletonscope) Enter(context Context) {
@@ -497,15 +807,103 @@ func (this *singletonscope) Exit(context Context) {
 	panic("You're always in singletonscope. Do not try to exit this scope.")
 }
 
-func (this *singletonscope) Scope(key Key, provider Provider) Provider {
-	return func(context Context, container Container) interface{} {
+// Returns the keys being provided by a container created by an injector, or nil for other containers.
+func provisioner(from Container) *[]InjectionPoint {
+	switch provisioning := from.(type) {
+	case container:
+		return provisioning.provisioning
+	case *container:
+		return provisioning.provisioning
+	}
+	return nil
+}
+
+// Returns whether the container providing a key is waiting, directly or not, for the waiter.
+func (this *singletonscope) waitsFor(by *[]InjectionPoint, waiter *[]InjectionPoint) bool {
+	for by != waiter {
+		provision, waiting := this.waiting[by]
+		if !waiting {
+			return false
+		}
+		by = provision.by
+	}
+	return true
+}
+
+/*
+	Returns the value of the key, waiting for it if another container is providing it. Returns
+	false if the key is to be provided by the caller, along with the provision to complete if the
+	caller is the first to provide it.
+*/
+func (this *singletonscope) await(key Key, waiter *[]InjectionPoint) (interface{}, bool, *provision) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for {
 		if value, exists := this.values[key]; exists {
-			return value
+			return value, true, nil
+		}
+		pending, providing := this.providing[key]
+		if !providing {
+			pending = &provision{waiter, make(chan struct{})}
+			this.providing[key] = pending
+			return nil, false, pending
+		}
+		if pending.by == waiter && waiter != nil {
+			panic(fmt.Sprintf("Already providing %s (%+v). Is there a cycle of dependencies?", key, reflect.TypeOf(key)))
 		}
+		// Waiting for a container that waits for the caller would never finish, so the caller provides
+		// the key as well and the value cached first is kept.
+		if waiter == nil || this.waitsFor(pending.by, waiter) {
+			return nil, false, nil
+		}
+		this.waiting[waiter] = pending
+		this.lock.Unlock()
+		<-pending.done
+		this.lock.Lock()
+		delete(this.waiting, waiter)
+		if _, exists := this.values[key]; !exists {
+			// The provider panicked, so the caller provides the key.
+			return nil, false, nil
+		}
+	}
+}
 
-		value := provider(context, container)
-		this.values[key] = value
+// Ends the provision of the key, whether or not its value was cached, and wakes its waiters.
+func (this *singletonscope) complete(key Key, pending *provision) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	delete(this.providing, key)
+	close(pending.done)
+}
 
-		return value
+/*
+	Caches the value of the key and returns it or, if the key was cached while the value was being
+	provided, returns the value cached first.
+*/
+func (this *singletonscope) cache(key Key, value interface{}) interface{} {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if cached, exists := this.values[key]; exists {
+		return cached
+	}
+	this.values[key] = value
+	return value
+}
+
+/*
+	Provides each key once: concurrent lookups wait for the value rather than holding a lock while it
+	is provided. When containers providing singletons look up each other's, one provides the other's
+	key as well rather than waiting, and the value cached first is kept.
+*/
+func (this *singletonscope) Scope(key Key, provider Provider) Provider {
+	return func(context Context, container Container) interface{} {
+		value, cached, pending := this.await(key, provisioner(container))
+		if cached {
+			return value
+		}
+		if pending != nil {
+			defer this.complete(key, pending)
+		}
+		return this.cache(key, provider(context, container))
 	}
 }
@@ -17,9 +17,14 @@
 package inject
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 // Tags that are primitive types. It is recommended to use const values if you go this way.
@@ -404,6 +409,84 @@ func TestSingletonScopedBinding(t *testing.T) {
 	}
 }
 
+func TestSingletonProvidedOnceForConcurrentLookups(t *testing.T) {
+	injector := CreateInjector()
+	provided := make(chan bool, 10)
+	release := make(chan bool)
+	injector.BindInScope(reflect.TypeOf(0), func(_ Context, _ Container) interface{} {
+		provided <- true
+		<-release
+		return 1
+	}, Singleton{})
+	var lookups sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		lookups.Add(1)
+		go func() {
+			defer lookups.Done()
+			injector.CreateContainer().GetInstance(nil, reflect.TypeOf(0))
+		}()
+	}
+	<-provided
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	lookups.Wait()
+	if len(provided) != 0 {
+		t.Error(fmt.Sprintf("Expected the singleton to be provided once, provided %d more times", len(provided)))
+	}
+}
+
+func TestMutuallyDependentSingletonsProvidedConcurrently(t *testing.T) {
+	injector := CreateInjector()
+	thing1Started, thing2Started := make(chan bool), make(chan bool)
+	injector.BindInScope(Thing1{}, func(context Context, container Container) interface{} {
+		if context == "thing1" {
+			close(thing1Started)
+			<-thing2Started
+			container.GetInstance(context, Thing2{})
+		}
+		return context
+	}, Singleton{})
+	injector.BindInScope(Thing2{}, func(context Context, container Container) interface{} {
+		if context == "thing2" {
+			close(thing2Started)
+			<-thing1Started
+			container.GetInstance(context, Thing1{})
+		}
+		return context
+	}, Singleton{})
+	done := make(chan interface{}, 2)
+	go func() { done <- injector.CreateContainer().GetInstance("thing1", Thing1{}) }()
+	go func() { done <- injector.CreateContainer().GetInstance("thing2", Thing2{}) }()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected the singletons to be provided, but the lookups deadlocked")
+		}
+	}
+	container := injector.CreateContainer()
+	if thing1, thing2 := container.GetInstance(nil, Thing1{}), container.GetInstance(nil, Thing2{}); thing1 == nil || thing2 == nil {
+		t.Error(fmt.Sprintf("Expected both singletons to be cached, got %v and %v", thing1, thing2))
+	}
+}
+
+func TestSingletonsOfSiblingChildInjectorsAreSeparate(t *testing.T) {
+	parent := CreateInjector()
+	alice := parent.CreateChildInjector()
+	bob := parent.CreateChildInjector()
+	alice.BindInstanceInScope(reflect.TypeOf(""), "alice", Singleton{})
+	bob.BindInstanceInScope(reflect.TypeOf(""), "bob", Singleton{})
+	alice.ExposeAndTag(reflect.TypeOf(""), Thing1{})
+	bob.ExposeAndTag(reflect.TypeOf(""), Thing2{})
+	container := parent.CreateContainer()
+	if value := container.GetTaggedInstance(nil, reflect.TypeOf(""), Thing1{}); value != "alice" {
+		t.Error(fmt.Sprintf("Expected alice's singleton, got %v", value))
+	}
+	if value := container.GetTaggedInstance(nil, reflect.TypeOf(""), Thing2{}); value != "bob" {
+		t.Error(fmt.Sprintf("Expected bob's singleton, got %v", value))
+	}
+}
+
 type TestScope struct{}
 
 func TestScopedBindingInvokedWhenScopeResets(t *testing.T) {
@@ -432,3 +515,177 @@ func TestScopedBindingInvokedWhenScopeResets(t *testing.T) {
 		t.Error(fmt.Sprintf("Scoped binding returned the same value when scope reset (%d == %d)", first, second))
 	}
 }
+
+func TestSeededValueIsNotProvided(t *testing.T) {
+	context := MyContext{"Seeded context"}
+	injector := CreateInjector()
+	scope := CreateSimpleScope().(SeedableScope)
+	injector.BindScope(scope, TestScope{})
+	injector.BindInScope(
+		reflect.TypeOf(0),
+		func(_ Context, _ Container) interface{} {
+			t.Error("Expected the seeded value to be used instead of the provider")
+			return 0
+		},
+		TestScope{})
+	scope.Enter(context)
+	scope.Seed(context, reflect.TypeOf(0), 42)
+	value := injector.CreateContainer().GetInstance(context, reflect.TypeOf(0))
+	if value != 42 {
+		t.Error(fmt.Sprintf("Expected the seeded value 42, got %v", value))
+	}
+	scope.Exit(context)
+
+	defer func() {
+		recover() // Expected
+	}()
+	scope.Seed(context, reflect.TypeOf(0), 42)
+	t.Error("Expected a panic when seeding a context that is not in scope")
+}
+
+func TestProvisionErrorHoldsKeyChain(t *testing.T) {
+	injector := CreateInjector()
+	injector.Bind(Thing1{}, func(context Context, container Container) interface{} {
+		return container.GetInstance(context, Thing2{})
+	})
+	injector.Bind(Thing2{}, func(context Context, container Container) interface{} {
+		return container.GetInstance(context, reflect.TypeOf(""))
+	})
+	_, failure := TryGetInstance(injector.CreateContainer(), nil, Thing1{})
+	err, ok := failure.(*ProvisionError)
+	if !ok {
+		t.Fatal(fmt.Sprintf("Expected a *ProvisionError, got %v", failure))
+	}
+	if len(err.Chain) != 3 || err.Chain[0] != (Thing1{}) || err.Chain[1] != (Thing2{}) ||
+		err.Chain[2] != reflect.TypeOf("") {
+		t.Error(fmt.Sprintf("Expected the chain Thing1 -> Thing2 -> string, got %v", err.Chain))
+	}
+	if len(err.Sources) != 3 || !strings.Contains(err.Sources[0], "injector_test.go") || err.Sources[2] != "" {
+		t.Error(fmt.Sprintf("Expected the sources of Thing1 and Thing2 only, got %v", err.Sources))
+	}
+	if value, err := TryGetInstance(injector.CreateContainer(), nil, Thing2{}); err == nil {
+		t.Error(fmt.Sprintf("Expected an error because string is not bound, got %v", value))
+	}
+}
+
+func TestProvisionErrorHoldsKeyChainInChildInjector(t *testing.T) {
+	parent := CreateInjector()
+	child := parent.CreateChildInjector()
+	var failure error
+	child.Bind(Thing1{}, func(context Context, container Container) interface{} {
+		_, failure = TryGetInstance(container, context, Thing2{})
+		return "recovered"
+	})
+	child.Bind(Thing2{}, func(context Context, container Container) interface{} {
+		return container.GetInstance(context, reflect.TypeOf(""))
+	})
+	child.Expose(Thing1{})
+	parent.CreateContainer().GetInstance(nil, Thing1{})
+	err, ok := failure.(*ProvisionError)
+	if !ok {
+		t.Fatal(fmt.Sprintf("Expected a *ProvisionError, got %v", failure))
+	}
+	if len(err.Chain) != 2 || err.Chain[0] != (Thing2{}) || err.Chain[1] != reflect.TypeOf("") {
+		t.Error(fmt.Sprintf("Expected the chain Thing2 -> string, got %v", err.Chain))
+	}
+}
+
+func TestGetInstanceDescribesFailuresUnderDescribingContext(t *testing.T) {
+	injector := CreateInjector()
+	injector.Bind(Thing1{}, func(context Context, container Container) interface{} {
+		return container.GetInstance(context, Thing2{})
+	})
+	defer func() {
+		err, ok := recover().(*ProvisionError)
+		if !ok || len(err.Chain) != 2 || err.Chain[0] != (Thing1{}) || err.Chain[1] != (Thing2{}) {
+			t.Error(fmt.Sprintf("Expected a *ProvisionError with the chain Thing1 -> Thing2, got %v", err))
+		}
+	}()
+	injector.CreateContainer().GetInstance(DescribeFailures(context.Background()), Thing1{})
+	t.Error("Expected a panic because Thing2 is not bound")
+}
+
+func TestGetInstancePanicsWithTheOriginalValue(t *testing.T) {
+	injector := CreateInjector()
+	injector.Bind(Thing1{}, func(context Context, container Container) interface{} {
+		return container.GetInstance(context, Thing2{})
+	})
+	injector.Bind(Thing2{}, func(context Context, container Container) interface{} {
+		panic(MyContext{"cause"})
+	})
+	defer func() {
+		if cause := recover(); cause != (MyContext{"cause"}) {
+			t.Error(fmt.Sprintf("Expected the provider's panic value, got %v", cause))
+		}
+	}()
+	injector.CreateContainer().GetInstance(nil, Thing1{})
+	t.Error("Expected a panic from the provider of Thing2")
+}
+
+func TestCurrentKeyIsTheKeyBeingProvided(t *testing.T) {
+	injector := CreateInjector()
+	var provided []Key
+	injector.Bind(Thing1{}, func(context Context, container Container) interface{} {
+		provided = append(provided, container.(InjectionPointContainer).CurrentKey())
+		container.GetInstance(context, Thing2{})
+		return append(provided, container.(InjectionPointContainer).CurrentKey())
+	})
+	injector.Bind(Thing2{}, func(context Context, container Container) interface{} {
+		provided = append(provided, container.(InjectionPointContainer).CurrentKey())
+		return nil
+	})
+	container := injector.CreateContainer()
+	provided = container.GetInstance(nil, Thing1{}).([]Key)
+	if len(provided) != 3 || provided[0] != (Thing1{}) || provided[1] != (Thing2{}) || provided[2] != (Thing1{}) {
+		t.Error(fmt.Sprintf("Expected Thing1, Thing2 then Thing1 again, got %v", provided))
+	}
+	if key := container.(InjectionPointContainer).CurrentKey(); key != nil {
+		t.Error(fmt.Sprintf("Expected no current key outside of providers, got %v", key))
+	}
+}
+
+func TestInjectionPointDescribesProvision(t *testing.T) {
+	injector := CreateInjector()
+	child := injector.CreateChildInjector()
+	points := make(map[Key]InjectionPoint)
+	child.Bind(Thing1{}, func(context Context, container Container) interface{} {
+		points[Thing1{}] = container.(InjectionPointContainer).InjectionPoint()
+		return container.GetInstance(context, Thing2{})
+	})
+	child.Expose(Thing1{})
+	injector.BindInScope(Thing2{}, func(context Context, container Container) interface{} {
+		points[Thing2{}] = container.(InjectionPointContainer).InjectionPoint()
+		return nil
+	}, Singleton{})
+
+	injector.CreateContainer().GetInstance(nil, Thing1{})
+	expected := map[Key]InjectionPoint{
+		Thing1{}: {Thing1{}, nil, child, nil},
+		Thing2{}: {Thing2{}, Thing1{}, injector, Singleton{}},
+	}
+	for key, point := range expected {
+		if points[key] != point {
+			t.Error(fmt.Sprintf("Expected %+v when providing %v, got %+v", point, key, points[key]))
+		}
+	}
+}
+
+func TestShutdownCallsHooksInReverseOrder(t *testing.T) {
+	injector := CreateInjector()
+	child := injector.CreateChildInjector()
+	var called []string
+	OnShutdown(injector, func() error {
+		called = append(called, "first")
+		return nil
+	})
+	OnShutdown(child, func() error {
+		called = append(called, "second")
+		return errors.New("failed")
+	})
+	if err := Shutdown(injector); err == nil || err.Error() != "failed" {
+		t.Error(fmt.Sprintf("Expected the error of the second hook, got %v", err))
+	}
+	if fmt.Sprint(called) != "[second first]" {
+		t.Error(fmt.Sprintf("Expected the hooks to be called in reverse order, got %v", called))
+	}
+}
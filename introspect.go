@@ -0,0 +1,250 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Returns a readable description of a key or tag, using its String method if it has one.
+func FormatKey(key Key) string {
+	if stringer, ok := key.(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	return fmt.Sprintf("%#v", key)
+}
+
+var packagePath = reflect.TypeOf(Singleton{}).PkgPath()
+
+// Returns the file, line and function of the first caller outside of this package or in its tests.
+func callerSource() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, packagePath+".") || strings.HasSuffix(frame.File, "_test.go") {
+			return fmt.Sprintf("%s:%d (%s)", frame.File, frame.Line, frame.Function)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+// A key that was looked up while providing another key.
+type dependency struct {
+	from Key
+	to   Key
+}
+
+/*
+	The dependencies looked up by providers, shared by an injector and all of its descendants. They
+	are only recorded once enabled, so lookups do not contend on the lock otherwise. See
+	RecordDependencies().
+*/
+type dependencies struct {
+	enabled atomic.Bool
+
+	lock  sync.Mutex
+	edges map[dependency]bool
+}
+
+func (this *dependencies) add(from Key, to Key) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.edges[dependency{from, to}] = true
+}
+
+/*
+	Records the keys looked up by each provider from now on, for the Dependencies of Describe(). The
+	recording applies to the injector along with all of its ancestors and descendants.
+*/
+func RecordDependencies(recorded Injector) {
+	recorded.(*injector).dependencies.enabled.Store(true)
+}
+
+// The keys a scope holds values for in one context.
+type CachedValues struct {
+	Context Context
+	Keys    []Key
+}
+
+// A Scope that can report the values it holds, for debugging. See Describe().
+type InspectableScope interface {
+	Scope
+
+	// Returns the keys with a value in the scope, for each active context.
+	Cached() []CachedValues
+}
+
+func (this *simplescope) Cached() []CachedValues {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	cached := make([]CachedValues, 0, len(this.values))
+	for context, values := range this.values {
+		keys := make([]Key, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		cached = append(cached, CachedValues{context, sortKeys(keys)})
+	}
+	return cached
+}
+
+func (this *simplescope) String() string {
+	return this.name
+}
+
+func (this *singletonscope) Cached() []CachedValues {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	keys := make([]Key, 0, len(this.values))
+	for key := range this.values {
+		keys = append(keys, key)
+	}
+	return []CachedValues{{nil, sortKeys(keys)}}
+}
+
+func sortKeys(keys []Key) []Key {
+	sort.Slice(keys, func(i, j int) bool { return FormatKey(keys[i]) < FormatKey(keys[j]) })
+	return keys
+}
+
+// A description of a binding. See Describe().
+type BindingDescription struct {
+	Key Key
+
+	// The tag of the scope caching the provided values, or nil if unscoped.
+	Scope Tag
+
+	// The file, line and function that made the binding.
+	Source string
+
+	// The key in the child injector, if the binding was exposed from a child injector.
+	ExposedFrom Key
+
+	// Whether the scope holds a value for the key in any context.
+	Cached bool
+}
+
+// A description of an injector and its child injectors. See Describe().
+type InjectorDescription struct {
+	Bindings []BindingDescription
+	Children []InjectorDescription
+}
+
+// A description of the contexts of a scope. See Describe().
+type ScopeDescription struct {
+	Tag Tag
+
+	// The values held by the scope, or nil if the scope is not an InspectableScope.
+	Cached []CachedValues
+}
+
+// A key that was looked up while providing another key.
+type Dependency struct {
+	From Key
+	To   Key
+}
+
+// A description of the state of an injector, for debugging. See Describe().
+type Description struct {
+	Injector InjectorDescription
+	Scopes   []ScopeDescription
+
+	// The dependencies between keys that have been provided since RecordDependencies() was called.
+	Dependencies []Dependency
+}
+
+/*
+	Describes an injector and its descendants: the bindings of each injector, the values held by
+	each scope, and the dependencies between keys that have been provided since RecordDependencies()
+	was called. The description is intended for debugging, and is sorted by the formatted keys and
+	tags.
+*/
+func Describe(described Injector) Description {
+	root := described.(*injector)
+
+	description := Description{}
+	cached := make(map[Tag]map[Key]bool)
+	for tag, scope := range root.scopes {
+		scopeDescription := ScopeDescription{Tag: tag}
+		if inspectable, ok := scope.(InspectableScope); ok {
+			scopeDescription.Cached = inspectable.Cached()
+			cached[tag] = make(map[Key]bool)
+			for _, values := range scopeDescription.Cached {
+				for _, key := range values.Keys {
+					cached[tag][key] = true
+				}
+			}
+		}
+		description.Scopes = append(description.Scopes, scopeDescription)
+	}
+	sort.Slice(description.Scopes, func(i, j int) bool {
+		return FormatKey(description.Scopes[i].Tag) < FormatKey(description.Scopes[j].Tag)
+	})
+
+	description.Injector = root.describe(cached)
+
+	root.dependencies.lock.Lock()
+	for edge := range root.dependencies.edges {
+		description.Dependencies = append(description.Dependencies, Dependency{edge.from, edge.to})
+	}
+	root.dependencies.lock.Unlock()
+	sort.Slice(description.Dependencies, func(i, j int) bool {
+		from, to := FormatKey(description.Dependencies[i].From), FormatKey(description.Dependencies[j].From)
+		if from != to {
+			return from < to
+		}
+		return FormatKey(description.Dependencies[i].To) < FormatKey(description.Dependencies[j].To)
+	})
+	return description
+}
+
+func (this *injector) describe(cached map[Tag]map[Key]bool) InjectorDescription {
+	description := InjectorDescription{}
+	for key, binding := range this.bindings {
+		// Scopes cache exposed values under the key in the child injector. See OwnedKey.
+		scopedKey := key
+		if binding.exposedFrom != nil {
+			scopedKey = binding.exposedFrom
+		}
+		if binding.injector.parent != nil {
+			scopedKey = OwnedKey{binding.injector.self, scopedKey}
+		}
+		description.Bindings = append(description.Bindings, BindingDescription{
+			Key:         key,
+			Scope:       binding.scope,
+			Source:      binding.source,
+			ExposedFrom: binding.exposedFrom,
+			Cached:      binding.scope != nil && cached[binding.scope][scopedKey],
+		})
+	}
+	sort.Slice(description.Bindings, func(i, j int) bool {
+		return FormatKey(description.Bindings[i].Key) < FormatKey(description.Bindings[j].Key)
+	})
+	for _, child := range this.children {
+		description.Children = append(description.Children, child.describe(cached))
+	}
+	return description
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject
+
+import (
+	"strings"
+	"testing"
+)
+
+type Database struct{}
+type Repository struct{}
+
+func TestDescribeBindings(t *testing.T) {
+	injector := CreateInjector()
+	injector.BindInScope(Database{}, func(_ Context, _ Container) interface{} { return "db" }, Singleton{})
+	child := injector.CreateChildInjector()
+	child.BindInstanceInScope(Repository{}, "repository", Singleton{})
+	child.Expose(Repository{})
+
+	description := Describe(injector)
+	bindings := description.Injector.Bindings
+	if len(bindings) != 2 {
+		t.Fatalf("Expected 2 bindings in the root injector, got %+v", bindings)
+	}
+	database, repository := bindings[0], bindings[1]
+	if database.Key != (Database{}) || database.Scope != (Singleton{}) || database.Cached {
+		t.Errorf("Expected an uninstantiated singleton Database, got %+v", database)
+	}
+	if !strings.Contains(database.Source, "introspect_test.go") {
+		t.Errorf("Expected the source to be the test, got %s", database.Source)
+	}
+	if repository.ExposedFrom != (Repository{}) {
+		t.Errorf("Expected Repository to be exposed from the child, got %+v", repository)
+	}
+	if children := description.Injector.Children; len(children) != 1 || len(children[0].Bindings) != 1 {
+		t.Errorf("Expected the child injector with one binding, got %+v", children)
+	}
+
+	injector.CreateContainer().GetInstance(nil, Database{})
+	if !Describe(injector).Injector.Bindings[0].Cached {
+		t.Error("Expected the Database singleton to be instantiated")
+	}
+	injector.CreateContainer().GetInstance(nil, Repository{})
+	description = Describe(injector)
+	if !description.Injector.Bindings[1].Cached || !description.Injector.Children[0].Bindings[0].Cached {
+		t.Error("Expected the Repository singleton of the child injector to be instantiated")
+	}
+}
+
+func TestDescribeScopesAndDependencies(t *testing.T) {
+	context := MyContext{"request"}
+	scope := CreateSimpleScopeWithName("Request")
+	injector := CreateInjector()
+	injector.BindScope(scope, TestScope{})
+	injector.BindInScope(Repository{}, func(context Context, container Container) interface{} {
+		return container.GetInstance(context, Database{})
+	}, TestScope{})
+	injector.BindInstance(Database{}, "db")
+	RecordDependencies(injector)
+
+	scope.Enter(context)
+	defer scope.Exit(context)
+	injector.CreateContainer().GetInstance(context, Repository{})
+
+	description := Describe(injector)
+	var cached []CachedValues
+	for _, scope := range description.Scopes {
+		if scope.Tag == (TestScope{}) {
+			cached = scope.Cached
+		}
+	}
+	if len(cached) != 1 || cached[0].Context != context || len(cached[0].Keys) != 1 || cached[0].Keys[0] != (Repository{}) {
+		t.Errorf("Expected Repository to be cached in the request, got %+v", cached)
+	}
+	expected := []Dependency{{Repository{}, Database{}}}
+	if len(description.Dependencies) != 1 || description.Dependencies[0] != expected[0] {
+		t.Errorf("Expected %+v, got %+v", expected, description.Dependencies)
+	}
+}
+
+func TestDependenciesAreNotRecordedUnlessEnabled(t *testing.T) {
+	injector := CreateInjector()
+	injector.Bind(Repository{}, func(context Context, container Container) interface{} {
+		return container.GetInstance(context, Database{})
+	})
+	injector.BindInstance(Database{}, "db")
+	injector.CreateContainer().GetInstance(nil, Repository{})
+	if dependencies := Describe(injector).Dependencies; len(dependencies) != 0 {
+		t.Errorf("Expected no dependencies to be recorded, got %+v", dependencies)
+	}
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+/*
+	Binds a root *slog.Logger, and gives providers loggers annotated with the key they are providing
+	and, while serving an inject_http request, the request's ID.
+*/
+package inject_log
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/http"
+	"code.google.com/p/go-inject/multi"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// Value for the log_level flag (default: INFO)
+var logLevel *string = flag.String("log_level", "INFO", "the minimum level of log records: DEBUG, INFO, WARN or ERROR")
+
+// Container key for the root *slog.Logger.
+type Logger struct{}
+
+// Container key for the minimum slog.Level of log records.
+type Level struct{}
+
+// Container key for the function creating the slog.Handler of the root logger.
+type Handler struct{}
+
+// Returns the optional binding of the handler, which defaults to a text handler.
+func boundHandler(injector inject.Injector) inject_multi.OptionalOf[func(slog.Leveler) slog.Handler] {
+	return inject_multi.EnsureOptionalOfBound[func(slog.Leveler) slog.Handler](injector, Handler{})
+}
+
+// Creates a handler writing text records at the level or above to standard error.
+func newTextHandler(level slog.Leveler) slog.Handler {
+	return slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+}
+
+// Binds the following:
+//   inject_log.Level - the value of the log_level flag
+func ConfigureFlags(injector inject.Injector) {
+	injector.Bind(Level{}, func(_ inject.Context, _ inject.Container) interface{} {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+			panic(fmt.Sprintf("Invalid log_level %q: %v", *logLevel, err))
+		}
+		return level
+	})
+}
+
+// Binds the following:
+//   inject_log.Logger{} - the root *slog.Logger
+//   inject_log.Handler{} - the func(slog.Leveler) slog.Handler creating the root logger's handler.
+//     This is the function bound with BindHandler, if any, or a text handler on standard error.
+// Requires these bindings:
+//   inject_log.Level - the minimum slog.Level of log records
+func ConfigureInjector(injector inject.Injector) {
+	var lock sync.Mutex
+	var root *slog.Logger
+	injector.Bind(Logger{}, func(_ inject.Context, container inject.Container) interface{} {
+		lock.Lock()
+		defer lock.Unlock()
+		if root == nil {
+			newHandler := container.GetInstance(nil, Handler{}).(func(slog.Leveler) slog.Handler)
+			root = slog.New(newHandler(container.GetInstance(nil, Level{}).(slog.Level)))
+		}
+		return root
+	})
+	boundHandler(injector).BindDefaultInstance(newTextHandler)
+}
+
+// Binds the function creating the handler of the root logger, in place of a text handler.
+func BindHandler(injector inject.Injector, newHandler func(level slog.Leveler) slog.Handler) {
+	boundHandler(injector).BindInstance(newHandler)
+}
+
+/*
+	Returns the root logger annotated with the key the calling Provider is providing, if its
+	container is an inject.InjectionPointContainer, and the ID of the request if context is an
+	inject_http request. The key is formatted with inject.FormatKey,
+	which formats tagged keys with TaggedKey.String and also formats the untagged keys that have no
+	String method, like Repository{}. A Provider calls this with its own context and container:
+
+	  injector.Bind(Repository{}, func(context inject.Context, container inject.Container) interface{} {
+	    return &repository{logger: inject_log.For(context, container)}
+	  })
+
+	This looks up inject_log.Logger and, in a request, inject_http.RequestID with the container. A
+	Container panics when a key is looked up through it twice, so the Provider may call For only
+	once, and must not look up those keys itself with the same container. Other Providers, including
+	those of the keys this Provider looks up, are passed their own containers and may call For.
+*/
+func For(context inject.Context, container inject.Container) *slog.Logger {
+	logger := container.GetInstance(context, Logger{}).(*slog.Logger)
+	if points, ok := container.(inject.InjectionPointContainer); ok && points.CurrentKey() != nil {
+		logger = logger.With("key", inject.FormatKey(points.CurrentKey()))
+	}
+	if _, ok := context.(*http.Request); ok {
+		logger = logger.With("request_id", container.GetInstance(context, inject_http.RequestID{}).(string))
+	}
+	return logger
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_log_test
+
+import (
+	"bytes"
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/http"
+	"code.google.com/p/go-inject/http/httptest"
+	"code.google.com/p/go-inject/log"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type Repository struct{}
+type Primary struct{}
+
+// Returns an injector logging JSON records to the buffer.
+func logInjector(buffer *bytes.Buffer) inject.Injector {
+	injector := inject.CreateInjector()
+	inject_log.ConfigureInjector(injector)
+	injector.BindInstance(inject_log.Level{}, slog.LevelDebug)
+	inject_log.BindHandler(injector, func(level slog.Leveler) slog.Handler {
+		return slog.NewJSONHandler(buffer, &slog.HandlerOptions{Level: level})
+	})
+	return injector
+}
+
+// Returns the attributes of the last record in the buffer.
+func lastRecord(t *testing.T, buffer *bytes.Buffer) map[string]interface{} {
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	record := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &record); err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+func TestLoggerIsAnnotatedWithProvidedKey(t *testing.T) {
+	var buffer bytes.Buffer
+	injector := logInjector(&buffer)
+	injector.BindTagged(Repository{}, Primary{}, func(context inject.Context, container inject.Container) interface{} {
+		inject_log.For(context, container).Debug("creating repository")
+		return "repository"
+	})
+
+	injector.CreateContainer().GetTaggedInstance(nil, Repository{}, Primary{})
+	record := lastRecord(t, &buffer)
+	if record["msg"] != "creating repository" || record["key"] != inject.FormatKey(inject.TaggedKey{Key: Repository{}, Tag: Primary{}}) {
+		t.Errorf("Expected the record to name the Repository<Primary> key, got %v", record)
+	}
+}
+
+func TestLoggerIsAnnotatedWithRequestID(t *testing.T) {
+	var buffer bytes.Buffer
+	injector := logInjector(&buffer)
+	inject_http.ConfigureScopes(injector)
+	inject_http.ConfigureInjector(injector)
+	injector.BindInScope(Repository{}, func(context inject.Context, container inject.Container) interface{} {
+		inject_log.For(context, container).Info("creating repository")
+		return "repository"
+	}, inject_http.RequestScoped{})
+	inject_http.BindHandlerFunc(injector, "/", func(w http.ResponseWriter, r *http.Request) {
+		injector.CreateContainer().GetInstance(r, Repository{})
+	})
+
+	request := httptest.NewRequest("GET", "http://localhost/", nil)
+	request.Header.Set(inject_http.RequestIDHeader, "abc123")
+	inject_httptest.New(injector).Do(request)
+	if record := lastRecord(t, &buffer); record["request_id"] != "abc123" || record["key"] != "inject_log_test.Repository{}" {
+		t.Errorf("Expected the record to have the key and request ID, got %v", record)
+	}
+}
+
+func TestProvidersOfDependenciesMayCallFor(t *testing.T) {
+	var buffer bytes.Buffer
+	injector := logInjector(&buffer)
+	injector.Bind(Repository{}, func(context inject.Context, container inject.Container) interface{} {
+		inject_log.For(context, container).Debug("creating repository")
+		return "repository"
+	})
+	injector.BindTagged(Repository{}, Primary{}, func(context inject.Context, container inject.Container) interface{} {
+		logger := inject_log.For(context, container)
+		repository := container.GetInstance(context, Repository{})
+		logger.Debug("creating primary repository")
+		return repository
+	})
+
+	injector.CreateContainer().GetTaggedInstance(nil, Repository{}, Primary{})
+	if record := lastRecord(t, &buffer); record["key"] != inject.FormatKey(inject.TaggedKey{Key: Repository{}, Tag: Primary{}}) {
+		t.Errorf("Expected the last record to name the Repository<Primary> key, got %v", record)
+	}
+	if !strings.Contains(buffer.String(), `"key":"inject_log_test.Repository{}"`) {
+		t.Errorf("Expected a record naming the Repository key, got %s", buffer.String())
+	}
+}
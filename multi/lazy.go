@@ -0,0 +1,115 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_multi
+
+import (
+	"code.google.com/p/go-inject"
+	"fmt"
+)
+
+/*
+	A view of a bound map that provisions each value the first time it is accessed, rather than
+	provisioning every value up front like the map tagged with Values{}. Scoped entries are cached
+	by their scope as usual; in addition, each value is provisioned at most once per view.
+
+	Untyped maps resolve the key tagged with Lazy{} to a *LazyMap[interface{}, interface{}]. Maps
+	declared with EnsureMapOfBound resolve it to a *LazyMap[K, V], and multimaps declared with
+	EnsureMultiMapOfBound to a *LazyMap[K, []V].
+
+	A LazyMap uses the Context and Container it was resolved with, so it should not outlive them.
+	It is not safe for concurrent use.
+*/
+type LazyMap[K comparable, V any] struct {
+	theMap    *boundMap
+	context   inject.Context
+	container inject.Container
+	providers map[interface{}]inject.Provider
+
+	// Converts a provided value to a V.
+	asValue func(interface{}) V
+
+	// Values provisioned so far.
+	values map[K]V
+}
+
+func newLazyMap[K comparable, V any](theMap *boundMap, context inject.Context, container inject.Container, providers map[interface{}]inject.Provider, asValue func(interface{}) V) *LazyMap[K, V] {
+	return &LazyMap[K, V]{
+		theMap:    theMap,
+		context:   context,
+		container: container,
+		providers: providers,
+		asValue:   asValue,
+		values:    make(map[K]V),
+	}
+}
+
+// Returns the keys of the map, in no particular order, without provisioning any values.
+func (this *LazyMap[K, V]) Keys() []K {
+	keys := make([]K, 0, len(this.providers))
+	for mapKey := range this.providers {
+		keys = append(keys, mapKey.(K))
+	}
+	return keys
+}
+
+// Returns the number of entries in the map.
+func (this *LazyMap[K, V]) Len() int {
+	return len(this.providers)
+}
+
+// Returns whether the map has an entry for mapKey, without provisioning it.
+func (this *LazyMap[K, V]) Contains(mapKey K) bool {
+	_, exists := this.providers[mapKey]
+	return exists
+}
+
+// Returns the value for mapKey, provisioning it if this is the first access.
+func (this *LazyMap[K, V]) Get(mapKey K) (V, bool) {
+	if value, exists := this.values[mapKey]; exists {
+		return value, true
+	}
+	provider, exists := this.providers[mapKey]
+	if !exists {
+		var zero V
+		return zero, false
+	}
+
+	provided := provider(this.context, this.container)
+	this.theMap.checkProvided(mapKey, provided)
+	value := this.asValue(provided)
+	this.values[mapKey] = value
+	return value, true
+}
+
+// A view of a bound set that provisions each element the first time it is accessed. See LazyMap.
+type LazySet[T any] struct {
+	elements *LazyMap[setIndex, T]
+}
+
+// Returns the number of elements in the set.
+func (this *LazySet[T]) Len() int {
+	return this.elements.Len()
+}
+
+// Returns the element at index, in binding order, provisioning it if this is the first access.
+func (this *LazySet[T]) Get(index int) T {
+	if index < 0 || index >= this.elements.Len() {
+		panic(fmt.Sprintf("Index %d is out of range for a set of %d elements.", index, this.elements.Len()))
+	}
+	value, _ := this.elements.Get(setIndex(index))
+	return value
+}
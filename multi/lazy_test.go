@@ -0,0 +1,104 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_multi
+
+import (
+	"code.google.com/p/go-inject"
+	"sort"
+	"testing"
+)
+
+// Binds a provider under name that records each time it is invoked.
+func bindRecording(injector inject.Injector, name string, provisioned map[string]int) {
+	BindMap(injector, Things{}, name, func(_ inject.Context, _ inject.Container) interface{} {
+		provisioned[name] += 1
+		return name
+	})
+}
+
+func TestLazyMapProvisionsOnFirstAccess(t *testing.T) {
+	injector := inject.CreateInjector()
+	provisioned := make(map[string]int)
+	bindRecording(injector, "foo", provisioned)
+	bindRecording(injector, "bar", provisioned)
+
+	lazy := injector.CreateContainer().GetTaggedInstance(nil, Things{}, Lazy{}).(*LazyMap[interface{}, interface{}])
+	keys := lazy.Keys()
+	if len(keys) != 2 || lazy.Len() != 2 || !lazy.Contains("foo") || lazy.Contains("baz") {
+		t.Errorf("Expected keys foo and bar, got %v", keys)
+	}
+	if len(provisioned) != 0 {
+		t.Errorf("Expected no values to be provisioned while listing keys, got %v", provisioned)
+	}
+
+	for i := 0; i < 2; i++ {
+		if value, ok := lazy.Get("foo"); !ok || value != "foo" {
+			t.Errorf("Expected foo, got %v", value)
+		}
+	}
+	if provisioned["foo"] != 1 || provisioned["bar"] != 0 {
+		t.Errorf("Expected only foo to be provisioned, once; got %v", provisioned)
+	}
+	if _, ok := lazy.Get("baz"); ok {
+		t.Error("Expected no value for baz")
+	}
+}
+
+func TestLazyMapRespectsScope(t *testing.T) {
+	injector := inject.CreateInjector()
+	BindMapInScope(injector, Things{}, "foo", counting(100), inject.Singleton{})
+	for i := 0; i < 2; i++ {
+		lazy := injector.CreateContainer().GetTaggedInstance(nil, Things{}, Lazy{}).(*LazyMap[interface{}, interface{}])
+		if value, _ := lazy.Get("foo"); value != 100 {
+			t.Errorf("Expected the singleton value 100, got %v", value)
+		}
+	}
+}
+
+func TestTypedLazyMap(t *testing.T) {
+	injector := inject.CreateInjector()
+	things := EnsureMapOfBound[string, int](injector, Things{})
+	things.BindInstance("foo", 1)
+	things.BindInstance("bar", 2)
+	lazy := injector.CreateContainer().GetTaggedInstance(nil, Things{}, Lazy{}).(*LazyMap[string, int])
+	keys := lazy.Keys()
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != "bar" || keys[1] != "foo" {
+		t.Errorf("Expected keys [bar foo], got %v", keys)
+	}
+	if value, ok := lazy.Get("bar"); !ok || value != 2 {
+		t.Errorf("Expected 2, got %v", value)
+	}
+}
+
+func TestLazySet(t *testing.T) {
+	injector := inject.CreateInjector()
+	names := EnsureSetOfBound[string](injector, Names{})
+	provisioned := 0
+	names.BindInstance("alice")
+	names.Bind(func(_ inject.Context, _ inject.Container) string {
+		provisioned += 1
+		return "bob"
+	})
+	lazy := injector.CreateContainer().GetTaggedInstance(nil, Names{}, Lazy{}).(*LazySet[string])
+	if lazy.Len() != 2 || lazy.Get(0) != "alice" || provisioned != 0 {
+		t.Errorf("Expected alice without provisioning bob")
+	}
+	if lazy.Get(1) != "bob" || provisioned != 1 {
+		t.Errorf("Expected bob to be provisioned on access")
+	}
+}
@@ -18,30 +18,178 @@ package inject_multi
 
 import (
 	"code.google.com/p/go-inject"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
 )
 
+/*
+	Policy applied when the same map key is bound more than once in a map. The default policy,
+	RejectDuplicates, panics with a message naming both registrations.
+*/
+type DuplicatePolicy int
+
+const (
+	// Panic when a map key is bound a second time.
+	RejectDuplicates DuplicatePolicy = iota
+
+	// Allow a map key to be bound again to an identical instance; any other duplicate panics.
+	PermitIdenticalDuplicates
+
+	// The last binding for a map key replaces any earlier binding.
+	LastWins
+
+	// Collect every binding for a map key into a []interface{}, in registration order.
+	CollectAll
+)
+
+func (this DuplicatePolicy) String() string {
+	switch this {
+	case RejectDuplicates:
+		return "RejectDuplicates"
+	case PermitIdenticalDuplicates:
+		return "PermitIdenticalDuplicates"
+	case LastWins:
+		return "LastWins"
+	case CollectAll:
+		return "CollectAll"
+	}
+	return fmt.Sprintf("DuplicatePolicy(%d)", int(this))
+}
+
 type mapsKey struct {
 	injector inject.Injector
 	key      inject.Key
 }
 
+// A single contribution to a map.
+type entry struct {
+	provider inject.Provider
+
+	// The bound instance, for instance bindings. Used to detect identical duplicates.
+	instance   interface{}
+	isInstance bool
+
+	// Where the binding was made. See CallerSource.
+	source string
+}
+
+/*
+	Key under which a single map entry is cached by its scope. Each entry gets its own key so that
+	scoped entries in the same map do not share a cache slot. Scopes are shared by every injector,
+	so the key also holds the map the entry belongs to: maps with the same key in sibling child
+	injectors must not share cache slots either.
+*/
+type entryKey struct {
+	owner  *boundMap
+	key    inject.Key
+	mapKey interface{}
+
+	// Distinguishes entries bound to the same map key (see CollectAll and LastWins).
+	sequence int
+}
+
+func (this entryKey) String() string {
+	return fmt.Sprintf("%s[%v]#%d", this.key, this.mapKey, this.sequence)
+}
+
+// The state backing a single bound map.
+type boundMap struct {
+	key    inject.Key
+	policy DuplicatePolicy
+
+	// The number of entries ever bound, used to give each entry a distinct entryKey.
+	sequence int
+
+	// The declared key and value types, or nil for an untyped map. See EnsureMapOfBound.
+	typed mapType
+
+	// The map bound in the injector. Mutated in place as entries are bound.
+	providers map[interface{}]inject.Provider
+
+	// Every entry bound for each map key, in registration order.
+	entries map[interface{}][]entry
+}
+
 // Map that holds the maps for each bound key.
-var maps map[mapsKey]map[interface{}]inject.Provider = make(map[mapsKey]map[interface{}]inject.Provider)
+var maps map[mapsKey]*boundMap = make(map[mapsKey]*boundMap)
 
+// Tag on a map key to get a map of values.
 type Values struct{}
 
-func createOrGetMap(injector inject.Injector, key inject.Key) map[interface{}]inject.Provider {
+// Tag on a map key to get a lazy view of the map. See LazyMap.
+type Lazy struct{}
+
+// Package paths whose frames are skipped when recording the source of a binding.
+var skippedSources = map[string]bool{reflect.TypeOf(Values{}).PkgPath(): true}
+
+/*
+	Skips frames from the given packages when recording where a map entry was bound. Packages that
+	wrap the Bind functions in this package (like inject_http) should call this so that duplicate
+	binding errors name their callers instead of the wrapper.
+*/
+func SkipSources(pkgPaths ...string) {
+	for _, pkgPath := range pkgPaths {
+		skippedSources[pkgPath] = true
+	}
+}
+
+func isSkippedSource(frame runtime.Frame) bool {
+	if strings.HasSuffix(frame.File, "_test.go") {
+		return false
+	}
+	name := frame.Function
+	// Trim any type parameters, which may themselves contain package paths.
+	if bracket := strings.Index(name, "["); bracket >= 0 {
+		name = name[:bracket]
+	}
+	// Trim the receiver/function part: the package path ends at the first '.' after the last '/'.
+	if slash := strings.LastIndex(name, "/"); slash >= 0 {
+		if dot := strings.Index(name[slash:], "."); dot >= 0 {
+			name = name[:slash+dot]
+		}
+	} else if dot := strings.Index(name, "."); dot >= 0 {
+		name = name[:dot]
+	}
+	return skippedSources[name]
+}
+
+/*
+	Returns the first caller outside of the packages skipped with SkipSources, as
+	"file:line (function)". This is the source recorded for each map entry.
+*/
+func CallerSource() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !isSkippedSource(frame) {
+			return fmt.Sprintf("%s:%d (%s)", frame.File, frame.Line, frame.Function)
+		}
+		if !more {
+			return "unknown source"
+		}
+	}
+}
+
+func createOrGetMap(injector inject.Injector, key inject.Key) *boundMap {
 	mapKey := mapsKey{injector, key}
 	if theMap, ok := maps[mapKey]; ok {
 		return theMap
 	}
 
-	theMap := make(map[interface{}]inject.Provider)
+	theMap := &boundMap{
+		key:       key,
+		policy:    RejectDuplicates,
+		providers: make(map[interface{}]inject.Provider),
+		entries:   make(map[interface{}][]entry),
+	}
 	maps[mapKey] = theMap
 	// Inject the map itself to get a map to providers.
-	injector.BindInstance(key, theMap)
+	injector.BindInstance(key, theMap.providers)
 	// Inject the map tagged with Values{} to get a map of values.
-	valueKey := inject.TaggedKey{key, Values{}}
+	valueKey := inject.TaggedKey{Key: key, Tag: Values{}}
 	injector.Bind(valueKey,
 		func(context inject.Context, container inject.Container) interface{} {
 			valueMap := make(map[interface{}]interface{})
@@ -49,63 +197,164 @@ func createOrGetMap(injector inject.Injector, key inject.Key) map[interface{}]in
 			for mapKey, provider := range providerMap {
 				valueMap[mapKey] = provider(context, container)
 			}
+			if theMap.typed != nil {
+				return theMap.convert(valueMap)
+			}
 			return valueMap
 		})
+	// Inject the map tagged with Lazy{} to get a view that provisions each value on first access.
+	lazyKey := inject.TaggedKey{Key: key, Tag: Lazy{}}
+	injector.Bind(lazyKey,
+		func(context inject.Context, container inject.Container) interface{} {
+			providerMap := container.GetInstance(context, key).(map[interface{}]inject.Provider)
+			if theMap.typed != nil {
+				return theMap.typed.lazy(theMap, context, container, providerMap)
+			}
+			return newLazyMap[interface{}, interface{}](theMap, context, container, providerMap, asValue[interface{}])
+		})
 	return theMap
 }
 
+// Returns a key that identifies the next entry bound to mapKey within a scope.
+func (this *boundMap) nextEntryKey(mapKey interface{}) entryKey {
+	this.sequence++
+	return entryKey{this, this.key, mapKey, this.sequence}
+}
+
+// Adds an entry to the map, applying the map's DuplicatePolicy.
+func (this *boundMap) add(mapKey interface{}, newEntry entry) {
+	this.checkEntry(mapKey, newEntry)
+	existing := this.entries[mapKey]
+	if len(existing) > 0 {
+		switch this.policy {
+		case LastWins:
+			existing = nil
+		case CollectAll:
+			// Every entry is kept; the collecting provider is already in place.
+		case PermitIdenticalDuplicates:
+			first := existing[0]
+			if first.isInstance && newEntry.isInstance &&
+				reflect.DeepEqual(first.instance, newEntry.instance) {
+				return
+			}
+			fallthrough
+		default:
+			panic(fmt.Sprintf("Map key %v is already bound in %s at %s; duplicate binding at %s.",
+				mapKey, this.key, existing[0].source, newEntry.source))
+		}
+	}
+
+	this.entries[mapKey] = append(existing, newEntry)
+	if this.policy == CollectAll {
+		this.providers[mapKey] = this.collectingProvider(mapKey)
+	} else {
+		this.providers[mapKey] = newEntry.provider
+	}
+}
+
+// Returns a Provider that provides a []interface{} holding the value of every entry for mapKey.
+func (this *boundMap) collectingProvider(mapKey interface{}) inject.Provider {
+	return func(context inject.Context, container inject.Container) interface{} {
+		entries := this.entries[mapKey]
+		values := make([]interface{}, 0, len(entries))
+		for _, entry := range entries {
+			values = append(values, entry.provider(context, container))
+		}
+		return values
+	}
+}
+
+func bindEntry(injector inject.Injector, key inject.Key, mapKey interface{}, provider inject.Provider) {
+	createOrGetMap(injector, key).add(mapKey, entry{provider: provider, source: CallerSource()})
+}
+
+func bindInstanceEntry(injector inject.Injector, key inject.Key, mapKey interface{}, provider inject.Provider, instance interface{}) {
+	createOrGetMap(injector, key).add(mapKey, entry{
+		provider:   provider,
+		instance:   instance,
+		isInstance: true,
+		source:     CallerSource(),
+	})
+}
+
+// Wraps provider to cache it in the scope bound to scopeTag, under a key unique to this entry.
+func scopeEntry(injector inject.Injector, key inject.Key, mapKey interface{}, provider inject.Provider, scopeTag inject.Tag) inject.Provider {
+	return injector.Scope(createOrGetMap(injector, key).nextEntryKey(mapKey), provider, scopeTag)
+}
+
 func EnsureMapBound(injector inject.Injector, key inject.Key) {
 	createOrGetMap(injector, key)
 }
 
+/*
+	Ensures the map is bound and sets the policy used when a map key is bound more than once. The
+	policy may only be changed before any entries are bound to the map.
+*/
+func EnsureMapBoundWithPolicy(injector inject.Injector, key inject.Key, policy DuplicatePolicy) {
+	theMap := createOrGetMap(injector, key)
+	if theMap.policy == policy {
+		return
+	}
+	if theMap.typed != nil && theMap.typed.collects() != (policy == CollectAll) {
+		panic(fmt.Sprintf("Map %s is declared as %s, which does not support policy %s.",
+			key, theMap.typed, policy))
+	}
+	if len(theMap.entries) > 0 {
+		panic(fmt.Sprintf("Map %s already has entries bound with policy %s; cannot change it to %s.",
+			key, theMap.policy, policy))
+	}
+	theMap.policy = policy
+}
+
 // Binds a type to a inject.Provider function.
 func BindMap(injector inject.Injector, key inject.Key, mapKey interface{}, provider inject.Provider) {
-	createOrGetMap(injector, key)[mapKey] = provider
+	bindEntry(injector, key, mapKey, provider)
 }
 
 // Binds a type to a single instance.
 func BindMapInstance(injector inject.Injector, key inject.Key, mapKey interface{}, instance interface{}) {
-	BindMap(injector, key, mapKey, func(_ inject.Context, _ inject.Container) interface{} { return instance })
+	bindInstanceEntry(injector, key, mapKey,
+		func(_ inject.Context, _ inject.Container) interface{} { return instance }, instance)
 }
 
-// Binds a key to a inject.Provider function, caching it within the specified scope.
+// Binds a key to a inject.Provider function, caching the entry on its own within the specified scope.
 func BindMapInScope(injector inject.Injector, key inject.Key, mapKey interface{}, provider inject.Provider, scopeTag inject.Tag) {
-	BindMap(injector, key, mapKey, injector.Scope(key, provider, scopeTag))
+	bindEntry(injector, key, mapKey, scopeEntry(injector, key, mapKey, provider, scopeTag))
 }
 
 // Binds a key to a single instance.
 func BindMapInstanceInScope(injector inject.Injector, key inject.Key, mapKey interface{}, instance interface{}, scopeTag inject.Tag) {
-	BindMapInScope(
+	bindInstanceEntry(
 		injector,
 		key,
 		mapKey,
-		func(_ inject.Context, _ inject.Container) interface{} { return instance },
-		scopeTag,
+		scopeEntry(
+			injector,
+			key,
+			mapKey,
+			func(_ inject.Context, _ inject.Container) interface{} { return instance },
+			scopeTag,
+		),
+		instance,
 	)
 }
 
 // Binds a tagged type to a inject.Provider function.
 func BindMapTagged(injector inject.Injector, key inject.Key, tag inject.Tag, mapKey interface{}, provider inject.Provider) {
-	BindMap(injector, inject.TaggedKey{key, tag}, mapKey, provider)
+	BindMap(injector, inject.TaggedKey{Key: key, Tag: tag}, mapKey, provider)
 }
 
 // Binds a tagged type to a inject.Provider function.
 func BindMapTaggedInScope(injector inject.Injector, key inject.Key, tag inject.Tag, mapKey interface{}, provider inject.Provider, scopeTag inject.Tag) {
-	BindMapInScope(injector, inject.TaggedKey{key, tag}, mapKey, provider, scopeTag)
+	BindMapInScope(injector, inject.TaggedKey{Key: key, Tag: tag}, mapKey, provider, scopeTag)
 }
 
 // Binds a tagged type to a single instance.
 func BindMapTaggedInstance(injector inject.Injector, key inject.Key, tag inject.Tag, mapKey interface{}, instance interface{}) {
-	BindMap(injector, inject.TaggedKey{key, tag}, mapKey, func(_ inject.Context, _ inject.Container) interface{} { return instance })
+	BindMapInstance(injector, inject.TaggedKey{Key: key, Tag: tag}, mapKey, instance)
 }
 
 // Binds a tagged type to a single instance.
 func BindMapTaggedInstanceInScope(injector inject.Injector, key inject.Key, tag inject.Tag, mapKey interface{}, instance interface{}, scopeTag inject.Tag) {
-	BindMapInScope(
-		injector,
-		inject.TaggedKey{key, tag},
-		mapKey,
-		func(_ inject.Context, _ inject.Container) interface{} { return instance },
-		scopeTag,
-	)
+	BindMapInstanceInScope(injector, inject.TaggedKey{Key: key, Tag: tag}, mapKey, instance, scopeTag)
 }
@@ -0,0 +1,193 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_multi
+
+import (
+	"code.google.com/p/go-inject"
+	"strings"
+	"testing"
+)
+
+type Things struct{}
+
+func getValues(injector inject.Injector, key inject.Key) map[interface{}]interface{} {
+	return injector.CreateContainer().GetTaggedInstance(nil, key, Values{}).(map[interface{}]interface{})
+}
+
+func TestMapBinding(t *testing.T) {
+	injector := inject.CreateInjector()
+	BindMapInstance(injector, Things{}, "foo", 1)
+	BindMap(injector, Things{}, "bar", func(_ inject.Context, _ inject.Container) interface{} { return 2 })
+	values := getValues(injector, Things{})
+	if values["foo"] != 1 || values["bar"] != 2 {
+		t.Errorf("Expected {foo: 1, bar: 2}, got %v", values)
+	}
+}
+
+func TestDuplicateMapKeyPanicsNamingBothSources(t *testing.T) {
+	injector := inject.CreateInjector()
+	BindMapInstance(injector, Things{}, "foo", 1)
+	defer func() {
+		message, _ := recover().(string)
+		if strings.Count(message, "map_test.go") != 2 {
+			t.Errorf("Expected the panic to name both bindings, got %q", message)
+		}
+	}()
+	BindMapInstance(injector, Things{}, "foo", 2)
+	t.Error("Expected a panic when binding map key foo twice")
+}
+
+func TestPermitIdenticalDuplicates(t *testing.T) {
+	injector := inject.CreateInjector()
+	EnsureMapBoundWithPolicy(injector, Things{}, PermitIdenticalDuplicates)
+	BindMapInstance(injector, Things{}, "foo", 1)
+	BindMapInstance(injector, Things{}, "foo", 1)
+	if values := getValues(injector, Things{}); values["foo"] != 1 {
+		t.Errorf("Expected foo to be 1, got %v", values["foo"])
+	}
+
+	defer func() {
+		recover() // Expected
+	}()
+	BindMapInstance(injector, Things{}, "foo", 2)
+	t.Error("Expected a panic when binding map key foo to a different value")
+}
+
+func TestLastWins(t *testing.T) {
+	injector := inject.CreateInjector()
+	EnsureMapBoundWithPolicy(injector, Things{}, LastWins)
+	BindMapInstance(injector, Things{}, "foo", 1)
+	BindMapInstance(injector, Things{}, "foo", 2)
+	if values := getValues(injector, Things{}); values["foo"] != 2 {
+		t.Errorf("Expected foo to be 2, got %v", values["foo"])
+	}
+}
+
+func TestCollectAll(t *testing.T) {
+	injector := inject.CreateInjector()
+	EnsureMapBoundWithPolicy(injector, Things{}, CollectAll)
+	BindMapInstance(injector, Things{}, "foo", 1)
+	BindMapInstance(injector, Things{}, "foo", 2)
+	BindMapInstance(injector, Things{}, "bar", 3)
+	values := getValues(injector, Things{})
+	foo := values["foo"].([]interface{})
+	if len(foo) != 2 || foo[0] != 1 || foo[1] != 2 {
+		t.Errorf("Expected foo to be [1 2], got %v", foo)
+	}
+	if bar := values["bar"].([]interface{}); len(bar) != 1 || bar[0] != 3 {
+		t.Errorf("Expected bar to be [3], got %v", bar)
+	}
+}
+
+func TestPolicyCannotChangeAfterBinding(t *testing.T) {
+	injector := inject.CreateInjector()
+	BindMapInstance(injector, Things{}, "foo", 1)
+	defer func() {
+		recover() // Expected
+	}()
+	EnsureMapBoundWithPolicy(injector, Things{}, LastWins)
+	t.Error("Expected a panic when changing the policy of a map with entries")
+}
+
+type RequestScoped struct{}
+
+type Counter struct{}
+
+// Returns a provider that returns start, start+1, ... on each invocation.
+func counting(start int) inject.Provider {
+	i := start - 1
+	return func(_ inject.Context, _ inject.Container) interface{} {
+		i += 1
+		return i
+	}
+}
+
+func TestSingletonScopedEntriesAreCachedPerEntry(t *testing.T) {
+	injector := inject.CreateInjector()
+	BindMapInScope(injector, Things{}, "foo", counting(100), inject.Singleton{})
+	BindMapInScope(injector, Things{}, "bar", counting(200), inject.Singleton{})
+	BindMapInstanceInScope(injector, Things{}, "baz", 300, inject.Singleton{})
+	for i := 0; i < 2; i++ {
+		values := getValues(injector, Things{})
+		if values["foo"] != 100 || values["bar"] != 200 || values["baz"] != 300 {
+			t.Errorf("Expected {foo: 100, bar: 200, baz: 300}, got %v", values)
+		}
+	}
+}
+
+func TestTaggedSingletonScopedEntriesAreCachedPerMap(t *testing.T) {
+	injector := inject.CreateInjector()
+	BindMapTaggedInScope(injector, Things{}, Counter{}, "foo", counting(100), inject.Singleton{})
+	BindMapInScope(injector, Things{}, "foo", counting(200), inject.Singleton{})
+	BindMapTaggedInstanceInScope(injector, Things{}, Counter{}, "bar", 300, inject.Singleton{})
+	tagged := getValues(injector, inject.TaggedKey{Key: Things{}, Tag: Counter{}})
+	untagged := getValues(injector, Things{})
+	if tagged["foo"] != 100 || tagged["bar"] != 300 || untagged["foo"] != 200 {
+		t.Errorf("Expected tagged {foo: 100, bar: 300} and untagged {foo: 200}, got %v and %v",
+			tagged, untagged)
+	}
+}
+
+func TestRequestScopedEntriesAreCachedPerEntry(t *testing.T) {
+	injector := inject.CreateInjector()
+	scope := inject.CreateSimpleScope()
+	injector.BindScope(scope, RequestScoped{})
+	BindMapInScope(injector, Things{}, "foo", counting(100), RequestScoped{})
+	BindMapTaggedInScope(injector, Things{}, Counter{}, "foo", counting(200), RequestScoped{})
+	BindMapTaggedInScope(injector, Things{}, Counter{}, "bar", counting(300), RequestScoped{})
+
+	get := func(context inject.Context) (map[interface{}]interface{}, map[interface{}]interface{}) {
+		untagged := injector.CreateContainer().GetTaggedInstance(context, Things{}, Values{})
+		tagged := injector.CreateContainer().GetTaggedInstance(
+			context, inject.TaggedKey{Key: Things{}, Tag: Counter{}}, Values{})
+		return untagged.(map[interface{}]interface{}), tagged.(map[interface{}]interface{})
+	}
+
+	first := "first request"
+	scope.Enter(first)
+	for i := 0; i < 2; i++ {
+		untagged, tagged := get(first)
+		if untagged["foo"] != 100 || tagged["foo"] != 200 || tagged["bar"] != 300 {
+			t.Errorf("Expected 100, 200 and 300 within the first request, got %v and %v", untagged, tagged)
+		}
+	}
+	scope.Exit(first)
+
+	second := "second request"
+	scope.Enter(second)
+	defer scope.Exit(second)
+	untagged, tagged := get(second)
+	if untagged["foo"] != 101 || tagged["foo"] != 201 || tagged["bar"] != 301 {
+		t.Errorf("Expected 101, 201 and 301 within the second request, got %v and %v", untagged, tagged)
+	}
+}
+
+func TestSingletonScopedEntriesAreCachedPerChildInjector(t *testing.T) {
+	injector := inject.CreateInjector()
+	first := injector.CreateChildInjector()
+	second := injector.CreateChildInjector()
+	BindMapInstanceInScope(first, Things{}, "foo", "first", inject.Singleton{})
+	BindMapInstanceInScope(second, Things{}, "foo", "second", inject.Singleton{})
+	for i := 0; i < 2; i++ {
+		if values := getValues(first, Things{}); values["foo"] != "first" {
+			t.Errorf("Expected foo to be \"first\" in the first child, got %v", values["foo"])
+		}
+		if values := getValues(second, Things{}); values["foo"] != "second" {
+			t.Errorf("Expected foo to be \"second\" in the second child, got %v", values["foo"])
+		}
+	}
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_multi
+
+import (
+	"code.google.com/p/go-inject"
+	"reflect"
+)
+
+/*
+	Ensures the multimap is bound. A multimap is a map that collects every contribution for a map
+	key, in binding order, so that a map key may have many values (for example, several listeners
+	for one event name). It is bound with the CollectAll policy: the key tagged with Values{}
+	resolves to a map[interface{}]interface{} whose values are []interface{}.
+
+	Multimaps are bound under the same keys as maps, so they can be tagged and exposed from a child
+	injector in the same way.
+*/
+func EnsureMultiMapBound(injector inject.Injector, key inject.Key) {
+	EnsureMapBoundWithPolicy(injector, key, CollectAll)
+}
+
+// Adds a inject.Provider function to the values of a map key.
+func BindMultiMap(injector inject.Injector, key inject.Key, mapKey interface{}, provider inject.Provider) {
+	EnsureMultiMapBound(injector, key)
+	bindEntry(injector, key, mapKey, provider)
+}
+
+// Adds a single instance to the values of a map key.
+func BindMultiMapInstance(injector inject.Injector, key inject.Key, mapKey interface{}, instance interface{}) {
+	EnsureMultiMapBound(injector, key)
+	BindMapInstance(injector, key, mapKey, instance)
+}
+
+// Adds a inject.Provider function to the values of a map key, caching it within the specified scope.
+func BindMultiMapInScope(injector inject.Injector, key inject.Key, mapKey interface{}, provider inject.Provider, scopeTag inject.Tag) {
+	EnsureMultiMapBound(injector, key)
+	BindMapInScope(injector, key, mapKey, provider, scopeTag)
+}
+
+// Adds a single instance to the values of a map key.
+func BindMultiMapInstanceInScope(injector inject.Injector, key inject.Key, mapKey interface{}, instance interface{}, scopeTag inject.Tag) {
+	EnsureMultiMapBound(injector, key)
+	BindMapInstanceInScope(injector, key, mapKey, instance, scopeTag)
+}
+
+// Adds a inject.Provider function to the values of a map key in a tagged multimap.
+func BindMultiMapTagged(injector inject.Injector, key inject.Key, tag inject.Tag, mapKey interface{}, provider inject.Provider) {
+	BindMultiMap(injector, inject.TaggedKey{Key: key, Tag: tag}, mapKey, provider)
+}
+
+// Adds a inject.Provider function to the values of a map key in a tagged multimap.
+func BindMultiMapTaggedInScope(injector inject.Injector, key inject.Key, tag inject.Tag, mapKey interface{}, provider inject.Provider, scopeTag inject.Tag) {
+	BindMultiMapInScope(injector, inject.TaggedKey{Key: key, Tag: tag}, mapKey, provider, scopeTag)
+}
+
+// Adds a single instance to the values of a map key in a tagged multimap.
+func BindMultiMapTaggedInstance(injector inject.Injector, key inject.Key, tag inject.Tag, mapKey interface{}, instance interface{}) {
+	BindMultiMapInstance(injector, inject.TaggedKey{Key: key, Tag: tag}, mapKey, instance)
+}
+
+// Adds a single instance to the values of a map key in a tagged multimap.
+func BindMultiMapTaggedInstanceInScope(injector inject.Injector, key inject.Key, tag inject.Tag, mapKey interface{}, instance interface{}, scopeTag inject.Tag) {
+	BindMultiMapInstanceInScope(injector, inject.TaggedKey{Key: key, Tag: tag}, mapKey, instance, scopeTag)
+}
+
+type multiMapOfType[K comparable, V any] struct{}
+
+func (this multiMapOfType[K, V]) checkKey(mapKey interface{}) bool {
+	_, ok := mapKey.(K)
+	return ok
+}
+
+func (this multiMapOfType[K, V]) checkValue(value interface{}) bool {
+	return isValue[V](value)
+}
+
+func asValues[V any](collected interface{}) []V {
+	elements := collected.([]interface{})
+	values := make([]V, 0, len(elements))
+	for _, element := range elements {
+		values = append(values, asValue[V](element))
+	}
+	return values
+}
+
+func (this multiMapOfType[K, V]) convert(valueMap map[interface{}]interface{}) interface{} {
+	typedMap := make(map[K][]V, len(valueMap))
+	for mapKey, collected := range valueMap {
+		typedMap[mapKey.(K)] = asValues[V](collected)
+	}
+	return typedMap
+}
+
+func (this multiMapOfType[K, V]) lazy(theMap *boundMap, context inject.Context, container inject.Container, providers map[interface{}]inject.Provider) interface{} {
+	return newLazyMap[K, []V](theMap, context, container, providers, asValues[V])
+}
+
+func (this multiMapOfType[K, V]) collects() bool {
+	return true
+}
+
+func (this multiMapOfType[K, V]) String() string {
+	return reflect.TypeOf((*map[K][]V)(nil)).Elem().String()
+}
+
+/*
+	A multimap whose keys are of type K and values of type V. See EnsureMultiMapBound and MapOf.
+	The key tagged with Values{} resolves to a map[K][]V.
+*/
+type MultiMapOf[K comparable, V any] struct {
+	injector inject.Injector
+	key      inject.Key
+}
+
+// Ensures the multimap is bound and declares its key and value types.
+func EnsureMultiMapOfBound[K comparable, V any](injector inject.Injector, key inject.Key) MultiMapOf[K, V] {
+	EnsureMultiMapBound(injector, key)
+	createOrGetMap(injector, key).declare(multiMapOfType[K, V]{})
+	return MultiMapOf[K, V]{injector, key}
+}
+
+// Adds a provider function to the values of a map key.
+func (this MultiMapOf[K, V]) Bind(mapKey K, provider func(inject.Context, inject.Container) V) {
+	bindEntry(this.injector, this.key, mapKey, untypedProvider(provider))
+}
+
+// Adds a single instance to the values of a map key.
+func (this MultiMapOf[K, V]) BindInstance(mapKey K, instance V) {
+	BindMapInstance(this.injector, this.key, mapKey, instance)
+}
+
+// Adds a provider function to the values of a map key, caching it within the specified scope.
+func (this MultiMapOf[K, V]) BindInScope(mapKey K, provider func(inject.Context, inject.Container) V, scopeTag inject.Tag) {
+	BindMapInScope(this.injector, this.key, mapKey, untypedProvider(provider), scopeTag)
+}
+
+// Adds a single instance to the values of a map key.
+func (this MultiMapOf[K, V]) BindInstanceInScope(mapKey K, instance V, scopeTag inject.Tag) {
+	BindMapInstanceInScope(this.injector, this.key, mapKey, instance, scopeTag)
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_multi
+
+import (
+	"code.google.com/p/go-inject"
+	"testing"
+)
+
+type Listeners struct{}
+
+func TestMultiMapCollectsValuesInOrder(t *testing.T) {
+	injector := inject.CreateInjector()
+	BindMultiMapInstance(injector, Listeners{}, "click", "first")
+	BindMultiMap(injector, Listeners{}, "click", func(_ inject.Context, _ inject.Container) interface{} { return "second" })
+	BindMultiMapInstance(injector, Listeners{}, "hover", "third")
+	values := getValues(injector, Listeners{})
+	click := values["click"].([]interface{})
+	if len(click) != 2 || click[0] != "first" || click[1] != "second" {
+		t.Errorf("Expected click to be [first second], got %v", click)
+	}
+	if hover := values["hover"].([]interface{}); len(hover) != 1 || hover[0] != "third" {
+		t.Errorf("Expected hover to be [third], got %v", hover)
+	}
+}
+
+func TestMultiMapScopesEachValue(t *testing.T) {
+	injector := inject.CreateInjector()
+	BindMultiMapTaggedInScope(injector, Listeners{}, Counter{}, "click", counting(100), inject.Singleton{})
+	BindMultiMapTaggedInScope(injector, Listeners{}, Counter{}, "click", counting(200), inject.Singleton{})
+	for i := 0; i < 2; i++ {
+		click := getValues(injector, inject.TaggedKey{Key: Listeners{}, Tag: Counter{}})["click"].([]interface{})
+		if len(click) != 2 || click[0] != 100 || click[1] != 200 {
+			t.Errorf("Expected click to be [100 200], got %v", click)
+		}
+	}
+}
+
+func TestMultiMapExposedFromChildInjector(t *testing.T) {
+	parent := inject.CreateInjector()
+	child := parent.CreateChildInjector()
+	BindMultiMapInstance(child, Listeners{}, "click", "first")
+	BindMultiMapInstance(child, Listeners{}, "click", "second")
+	child.Expose(Listeners{})
+	child.ExposeTagged(Listeners{}, Values{})
+	click := getValues(parent, Listeners{})["click"].([]interface{})
+	if len(click) != 2 || click[0] != "first" || click[1] != "second" {
+		t.Errorf("Expected click to be [first second], got %v", click)
+	}
+}
+
+func TestMultiMapOf(t *testing.T) {
+	injector := inject.CreateInjector()
+	listeners := EnsureMultiMapOfBound[string, int](injector, Listeners{})
+	listeners.BindInstance("click", 1)
+	listeners.Bind("click", func(_ inject.Context, _ inject.Container) int { return 2 })
+	values := injector.CreateContainer().GetTaggedInstance(nil, Listeners{}, Values{}).(map[string][]int)
+	if click := values["click"]; len(click) != 2 || click[0] != 1 || click[1] != 2 {
+		t.Errorf("Expected click to be [1 2], got %v", click)
+	}
+
+	lazy := injector.CreateContainer().GetTaggedInstance(nil, Listeners{}, Lazy{}).(*LazyMap[string, []int])
+	if click, _ := lazy.Get("click"); len(click) != 2 {
+		t.Errorf("Expected click to be [1 2], got %v", click)
+	}
+}
+
+func TestMultiMapCannotBeDeclaredAsMap(t *testing.T) {
+	injector := inject.CreateInjector()
+	EnsureMultiMapBound(injector, Listeners{})
+	defer func() {
+		recover() // Expected
+	}()
+	EnsureMapOfBound[string, int](injector, Listeners{})
+	t.Error("Expected a panic when declaring a multimap as a map")
+}
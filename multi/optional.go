@@ -0,0 +1,118 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_multi
+
+import (
+	"code.google.com/p/go-inject"
+	"fmt"
+)
+
+// Tag on the key of an optional binding for the map holding its value and default.
+type optional struct{}
+
+// Map key for the value and the default of an optional binding.
+type optionalSlot int
+
+const (
+	boundValue optionalSlot = iota
+	defaultValue
+)
+
+func (this optionalSlot) String() string {
+	if this == defaultValue {
+		return "default"
+	}
+	return "value"
+}
+
+/*
+	An optional binding of a key to a value of type T. A module may bind a default for the key, and
+	any module may replace the default by binding the value, so a package can offer a bindable
+	value like a listener or a codec without failing when nothing is bound. Binding the value or the
+	default twice panics, naming both callers.
+
+	The key resolves to the value if it is bound, or else to the default, and panics if neither is
+	bound. GetOptional reports whether either is bound instead of panicking.
+*/
+type OptionalOf[T any] struct {
+	slots MapOf[optionalSlot, T]
+}
+
+/*
+	Ensures the optional binding of the key is bound and declares its type. Every module using the
+	optional binding must declare the same type.
+*/
+func EnsureOptionalOfBound[T any](injector inject.Injector, key inject.Key) OptionalOf[T] {
+	slotsKey := inject.TaggedKey{Key: key, Tag: optional{}}
+	_, exists := maps[mapsKey{injector, slotsKey}]
+	slots := EnsureMapOfBound[optionalSlot, T](injector, slotsKey)
+	if !exists {
+		injector.Bind(key, func(context inject.Context, container inject.Container) interface{} {
+			if value, ok := GetOptional[T](context, container, key); ok {
+				return value
+			}
+			panic(fmt.Sprintf("Neither a value nor a default is bound to optional %s.", key))
+		})
+	}
+	return OptionalOf[T]{slots}
+}
+
+/*
+	Returns the value bound to the optional binding of the key or, if no value is bound, its default.
+	Returns false if neither is bound. Only the returned value or default is provided.
+*/
+func GetOptional[T any](context inject.Context, container inject.Container, key inject.Key) (T, bool) {
+	slots := container.GetTaggedInstance(
+		context,
+		inject.TaggedKey{Key: key, Tag: optional{}},
+		Lazy{},
+	).(*LazyMap[optionalSlot, T])
+	if value, ok := slots.Get(boundValue); ok {
+		return value, true
+	}
+	return slots.Get(defaultValue)
+}
+
+// Binds the value to a provider function, replacing the default.
+func (this OptionalOf[T]) Bind(provider func(inject.Context, inject.Container) T) {
+	this.slots.Bind(boundValue, provider)
+}
+
+// Binds the value to a single instance, replacing the default.
+func (this OptionalOf[T]) BindInstance(instance T) {
+	this.slots.BindInstance(boundValue, instance)
+}
+
+// Binds the value to a provider function, caching it within the specified scope.
+func (this OptionalOf[T]) BindInScope(provider func(inject.Context, inject.Container) T, scopeTag inject.Tag) {
+	this.slots.BindInScope(boundValue, provider, scopeTag)
+}
+
+// Binds the default to a provider function, used when no value is bound.
+func (this OptionalOf[T]) BindDefault(provider func(inject.Context, inject.Container) T) {
+	this.slots.Bind(defaultValue, provider)
+}
+
+// Binds the default to a single instance, used when no value is bound.
+func (this OptionalOf[T]) BindDefaultInstance(instance T) {
+	this.slots.BindInstance(defaultValue, instance)
+}
+
+// Binds the default to a provider function, caching it within the specified scope.
+func (this OptionalOf[T]) BindDefaultInScope(provider func(inject.Context, inject.Container) T, scopeTag inject.Tag) {
+	this.slots.BindInScope(defaultValue, provider, scopeTag)
+}
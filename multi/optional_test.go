@@ -0,0 +1,89 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_multi
+
+import (
+	"code.google.com/p/go-inject"
+	"strings"
+	"testing"
+)
+
+type Greeting struct{}
+
+func TestOptionalResolvesToDefaultUnlessValueIsBound(t *testing.T) {
+	injector := inject.CreateInjector()
+	EnsureOptionalOfBound[string](injector, Greeting{}).BindDefaultInstance("hello")
+	if greeting := injector.CreateContainer().GetInstance(nil, Greeting{}); greeting != "hello" {
+		t.Errorf("Expected the default \"hello\", got %v", greeting)
+	}
+
+	EnsureOptionalOfBound[string](injector, Greeting{}).Bind(func(_ inject.Context, _ inject.Container) string {
+		return "hi"
+	})
+	if greeting := injector.CreateContainer().GetInstance(nil, Greeting{}); greeting != "hi" {
+		t.Errorf("Expected the bound value \"hi\", got %v", greeting)
+	}
+}
+
+func TestGetOptionalReportsWhetherBound(t *testing.T) {
+	injector := inject.CreateInjector()
+	greeting := EnsureOptionalOfBound[string](injector, Greeting{})
+	if value, ok := GetOptional[string](nil, injector.CreateContainer(), Greeting{}); ok {
+		t.Errorf("Expected nothing to be bound, got %q", value)
+	}
+	greeting.BindInstance("hello")
+	if value, ok := GetOptional[string](nil, injector.CreateContainer(), Greeting{}); !ok || value != "hello" {
+		t.Errorf("Expected \"hello\" to be bound, got %q", value)
+	}
+}
+
+func TestOptionalPanicsWhenNothingIsBound(t *testing.T) {
+	injector := inject.CreateInjector()
+	EnsureOptionalOfBound[string](injector, Greeting{})
+	defer func() {
+		recover() // Expected
+	}()
+	injector.CreateContainer().GetInstance(nil, Greeting{})
+	t.Error("Expected a panic when neither a value nor a default is bound")
+}
+
+func TestOptionalValueBoundTwicePanicsNamingBothSources(t *testing.T) {
+	injector := inject.CreateInjector()
+	EnsureOptionalOfBound[string](injector, Greeting{}).BindInstance("hello")
+	defer func() {
+		message, _ := recover().(string)
+		if strings.Count(message, "optional_test.go") != 2 {
+			t.Errorf("Expected the panic to name both bindings, got %q", message)
+		}
+	}()
+	EnsureOptionalOfBound[string](injector, Greeting{}).BindInstance("hi")
+	t.Error("Expected a panic when binding the value twice")
+}
+
+func TestOptionalValueInScopeIsCached(t *testing.T) {
+	injector := inject.CreateInjector()
+	i := 0
+	EnsureOptionalOfBound[int](injector, Counter{}).BindInScope(func(_ inject.Context, _ inject.Container) int {
+		i += 1
+		return i
+	}, inject.Singleton{})
+	for j := 0; j < 2; j++ {
+		if value := injector.CreateContainer().GetInstance(nil, Counter{}); value != 1 {
+			t.Errorf("Expected the singleton value 1, got %v", value)
+		}
+	}
+}
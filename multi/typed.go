@@ -0,0 +1,282 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_multi
+
+import (
+	"code.google.com/p/go-inject"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// The declared key and value types of a map, used to check entries and build the typed values.
+type mapType interface {
+	checkKey(mapKey interface{}) bool
+	checkValue(value interface{}) bool
+	convert(valueMap map[interface{}]interface{}) interface{}
+	lazy(theMap *boundMap, context inject.Context, container inject.Container, providers map[interface{}]inject.Provider) interface{}
+
+	// Whether the map collects every entry for a map key (see CollectAll).
+	collects() bool
+	String() string
+}
+
+// Returns whether value can be used as a V. A nil value is accepted when V's zero value is nil.
+func isValue[V any](value interface{}) bool {
+	if value == nil {
+		var zero V
+		return interface{}(zero) == nil
+	}
+	_, ok := value.(V)
+	return ok
+}
+
+func asValue[V any](value interface{}) V {
+	if value == nil {
+		var zero V
+		return zero
+	}
+	return value.(V)
+}
+
+// Wraps a typed provider function as an inject.Provider.
+func untypedProvider[V any](provider func(inject.Context, inject.Container) V) inject.Provider {
+	return func(context inject.Context, container inject.Container) interface{} {
+		return provider(context, container)
+	}
+}
+
+type mapOfType[K comparable, V any] struct{}
+
+func (this mapOfType[K, V]) checkKey(mapKey interface{}) bool {
+	_, ok := mapKey.(K)
+	return ok
+}
+
+func (this mapOfType[K, V]) checkValue(value interface{}) bool {
+	return isValue[V](value)
+}
+
+func (this mapOfType[K, V]) convert(valueMap map[interface{}]interface{}) interface{} {
+	typedMap := make(map[K]V, len(valueMap))
+	for mapKey, value := range valueMap {
+		typedMap[mapKey.(K)] = asValue[V](value)
+	}
+	return typedMap
+}
+
+func (this mapOfType[K, V]) lazy(theMap *boundMap, context inject.Context, container inject.Container, providers map[interface{}]inject.Provider) interface{} {
+	return newLazyMap[K, V](theMap, context, container, providers, asValue[V])
+}
+
+func (this mapOfType[K, V]) collects() bool {
+	return false
+}
+
+func (this mapOfType[K, V]) String() string {
+	return reflect.TypeOf((*map[K]V)(nil)).Elem().String()
+}
+
+// Map key used for each entry of a set, in binding order.
+type setIndex int
+
+type setOfType[T any] struct{}
+
+func (this setOfType[T]) checkKey(mapKey interface{}) bool {
+	_, ok := mapKey.(setIndex)
+	return ok
+}
+
+func (this setOfType[T]) checkValue(value interface{}) bool {
+	return isValue[T](value)
+}
+
+func (this setOfType[T]) convert(valueMap map[interface{}]interface{}) interface{} {
+	indexes := make([]int, 0, len(valueMap))
+	for index := range valueMap {
+		indexes = append(indexes, int(index.(setIndex)))
+	}
+	sort.Ints(indexes)
+	values := make([]T, 0, len(indexes))
+	for _, index := range indexes {
+		values = append(values, asValue[T](valueMap[setIndex(index)]))
+	}
+	return values
+}
+
+func (this setOfType[T]) lazy(theMap *boundMap, context inject.Context, container inject.Container, providers map[interface{}]inject.Provider) interface{} {
+	return &LazySet[T]{newLazyMap[setIndex, T](theMap, context, container, providers, asValue[T])}
+}
+
+func (this setOfType[T]) collects() bool {
+	return false
+}
+
+func (this setOfType[T]) String() string {
+	return reflect.TypeOf((*[]T)(nil)).Elem().String()
+}
+
+// Panics if the entry does not match the declared types of the map.
+func (this *boundMap) checkEntry(mapKey interface{}, newEntry entry) {
+	if this.typed == nil {
+		return
+	}
+	if !this.typed.checkKey(mapKey) {
+		panic(fmt.Sprintf("Map key %v (%T) bound at %s does not match %s declared for %s.",
+			mapKey, mapKey, newEntry.source, this.typed, this.key))
+	}
+	if newEntry.isInstance && !this.typed.checkValue(newEntry.instance) {
+		panic(fmt.Sprintf("Value %v (%T) bound to map key %v at %s does not match %s declared for %s.",
+			newEntry.instance, newEntry.instance, mapKey, newEntry.source, this.typed, this.key))
+	}
+}
+
+// Panics if a value provided for mapKey does not match the declared value type of the map.
+func (this *boundMap) checkProvided(mapKey interface{}, value interface{}) {
+	if this.typed == nil {
+		return
+	}
+	entries := this.entries[mapKey]
+	if this.policy == CollectAll {
+		// The value holds the value of each entry, in order.
+		for i, element := range value.([]interface{}) {
+			this.checkProvidedEntry(mapKey, element, entries[i])
+		}
+		return
+	}
+	this.checkProvidedEntry(mapKey, value, entries[len(entries)-1])
+}
+
+func (this *boundMap) checkProvidedEntry(mapKey interface{}, value interface{}, providedBy entry) {
+	if !this.typed.checkValue(value) {
+		panic(fmt.Sprintf("Value %v (%T) provided for map key %v bound at %s does not match %s declared for %s.",
+			value, value, mapKey, providedBy.source, this.typed, this.key))
+	}
+}
+
+// Converts the provided values to the declared type, checking values from untyped providers.
+func (this *boundMap) convert(valueMap map[interface{}]interface{}) interface{} {
+	for mapKey, value := range valueMap {
+		this.checkProvided(mapKey, value)
+	}
+	return this.typed.convert(valueMap)
+}
+
+// Declares the types of the map, checking any entries that are already bound.
+func (this *boundMap) declare(typed mapType) {
+	if this.typed != nil {
+		if this.typed != typed {
+			panic(fmt.Sprintf("Map %s is already declared as %s; cannot declare it as %s.",
+				this.key, this.typed, typed))
+		}
+		return
+	}
+	if typed.collects() != (this.policy == CollectAll) {
+		panic(fmt.Sprintf("Map %s uses policy %s, which is not supported by %s.", this.key, this.policy, typed))
+	}
+	this.typed = typed
+	for mapKey, entries := range this.entries {
+		for _, entry := range entries {
+			this.checkEntry(mapKey, entry)
+		}
+	}
+}
+
+/*
+	A map multibinder whose keys are of type K and values of type V. The key and value types are
+	declared when the map is bound (see EnsureMapOfBound), and each contribution is checked against
+	them when it is bound.
+
+	The map binds the same keys as an untyped map, except that the key tagged with Values{}
+	resolves to a map[K]V and the key tagged with Lazy{} resolves to a *LazyMap[K, V].
+*/
+type MapOf[K comparable, V any] struct {
+	injector inject.Injector
+	key      inject.Key
+}
+
+/*
+	Ensures the map is bound and declares its key and value types. Every module contributing to the
+	map must declare the same types. Entries bound with the untyped functions (BindMap etc.) are
+	checked as well: keys and instances when they are bound, and provided values when they are
+	resolved.
+*/
+func EnsureMapOfBound[K comparable, V any](injector inject.Injector, key inject.Key) MapOf[K, V] {
+	createOrGetMap(injector, key).declare(mapOfType[K, V]{})
+	return MapOf[K, V]{injector, key}
+}
+
+// Binds a map key to a provider function.
+func (this MapOf[K, V]) Bind(mapKey K, provider func(inject.Context, inject.Container) V) {
+	bindEntry(this.injector, this.key, mapKey, untypedProvider(provider))
+}
+
+// Binds a map key to a single instance.
+func (this MapOf[K, V]) BindInstance(mapKey K, instance V) {
+	BindMapInstance(this.injector, this.key, mapKey, instance)
+}
+
+// Binds a map key to a provider function, caching the entry on its own within the specified scope.
+func (this MapOf[K, V]) BindInScope(mapKey K, provider func(inject.Context, inject.Container) V, scopeTag inject.Tag) {
+	BindMapInScope(this.injector, this.key, mapKey, untypedProvider(provider), scopeTag)
+}
+
+// Binds a map key to a single instance.
+func (this MapOf[K, V]) BindInstanceInScope(mapKey K, instance V, scopeTag inject.Tag) {
+	BindMapInstanceInScope(this.injector, this.key, mapKey, instance, scopeTag)
+}
+
+/*
+	A set multibinder whose elements are of type T. The key tagged with Values{} resolves to a []T
+	holding every element in the order it was bound, and the key tagged with Lazy{} resolves to a
+	*LazySet[T].
+*/
+type SetOf[T any] struct {
+	injector inject.Injector
+	key      inject.Key
+}
+
+// Ensures the set is bound and declares its element type.
+func EnsureSetOfBound[T any](injector inject.Injector, key inject.Key) SetOf[T] {
+	createOrGetMap(injector, key).declare(setOfType[T]{})
+	return SetOf[T]{injector, key}
+}
+
+// Returns the map key for the next element of the set.
+func (this SetOf[T]) nextIndex() setIndex {
+	return setIndex(len(createOrGetMap(this.injector, this.key).entries))
+}
+
+// Adds a provider function to the set.
+func (this SetOf[T]) Bind(provider func(inject.Context, inject.Container) T) {
+	bindEntry(this.injector, this.key, this.nextIndex(), untypedProvider(provider))
+}
+
+// Adds a single instance to the set.
+func (this SetOf[T]) BindInstance(instance T) {
+	BindMapInstance(this.injector, this.key, this.nextIndex(), instance)
+}
+
+// Adds a provider function to the set, caching the element on its own within the specified scope.
+func (this SetOf[T]) BindInScope(provider func(inject.Context, inject.Container) T, scopeTag inject.Tag) {
+	BindMapInScope(this.injector, this.key, this.nextIndex(), untypedProvider(provider), scopeTag)
+}
+
+// Adds a single instance to the set.
+func (this SetOf[T]) BindInstanceInScope(instance T, scopeTag inject.Tag) {
+	BindMapInstanceInScope(this.injector, this.key, this.nextIndex(), instance, scopeTag)
+}
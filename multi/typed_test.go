@@ -0,0 +1,102 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_multi
+
+import (
+	"code.google.com/p/go-inject"
+	"testing"
+)
+
+type Names struct{}
+
+func TestMapOfResolvesTypedMap(t *testing.T) {
+	injector := inject.CreateInjector()
+	things := EnsureMapOfBound[string, int](injector, Things{})
+	things.BindInstance("foo", 1)
+	things.Bind("bar", func(_ inject.Context, _ inject.Container) int { return 2 })
+	BindMapInstance(injector, Things{}, "baz", 3)
+	values := injector.CreateContainer().GetTaggedInstance(nil, Things{}, Values{}).(map[string]int)
+	if len(values) != 3 || values["foo"] != 1 || values["bar"] != 2 || values["baz"] != 3 {
+		t.Errorf("Expected {foo: 1, bar: 2, baz: 3}, got %v", values)
+	}
+}
+
+func TestMapOfRejectsMismatchedInstance(t *testing.T) {
+	injector := inject.CreateInjector()
+	EnsureMapOfBound[string, int](injector, Things{})
+	defer func() {
+		recover() // Expected
+	}()
+	BindMapInstance(injector, Things{}, "foo", "one")
+	t.Error("Expected a panic when binding a string into a map of ints")
+}
+
+func TestMapOfRejectsMismatchedKey(t *testing.T) {
+	injector := inject.CreateInjector()
+	EnsureMapOfBound[string, int](injector, Things{})
+	defer func() {
+		recover() // Expected
+	}()
+	BindMapInstance(injector, Things{}, 1, 1)
+	t.Error("Expected a panic when binding an int key into a map keyed by strings")
+}
+
+func TestMapOfChecksEntriesBoundBeforeDeclaration(t *testing.T) {
+	injector := inject.CreateInjector()
+	BindMapInstance(injector, Things{}, "foo", "one")
+	defer func() {
+		recover() // Expected
+	}()
+	EnsureMapOfBound[string, int](injector, Things{})
+	t.Error("Expected a panic when declaring a map of ints holding a string")
+}
+
+func TestMapOfRejectsMismatchedProvidedValue(t *testing.T) {
+	injector := inject.CreateInjector()
+	EnsureMapOfBound[string, int](injector, Things{})
+	BindMap(injector, Things{}, "foo", func(_ inject.Context, _ inject.Container) interface{} { return "one" })
+	defer func() {
+		recover() // Expected
+	}()
+	injector.CreateContainer().GetTaggedInstance(nil, Things{}, Values{})
+	t.Error("Expected a panic when resolving a map of ints holding a string")
+}
+
+func TestMapOfRejectsRedeclaration(t *testing.T) {
+	injector := inject.CreateInjector()
+	EnsureMapOfBound[string, int](injector, Things{})
+	EnsureMapOfBound[string, int](injector, Things{})
+	defer func() {
+		recover() // Expected
+	}()
+	EnsureMapOfBound[string, string](injector, Things{})
+	t.Error("Expected a panic when declaring the map with different types")
+}
+
+func TestSetOfResolvesSliceInBindingOrder(t *testing.T) {
+	injector := inject.CreateInjector()
+	names := EnsureSetOfBound[string](injector, Names{})
+	names.BindInstance("alice")
+	names.Bind(func(_ inject.Context, _ inject.Container) string { return "bob" })
+	names.BindInstanceInScope("carol", inject.Singleton{})
+	EnsureSetOfBound[string](injector, Names{}).BindInstance("dave")
+	values := injector.CreateContainer().GetTaggedInstance(nil, Names{}, Values{}).([]string)
+	if len(values) != 4 || values[0] != "alice" || values[1] != "bob" || values[2] != "carol" ||
+		values[3] != "dave" {
+		t.Errorf("Expected [alice bob carol dave], got %v", values)
+	}
+}
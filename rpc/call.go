@@ -0,0 +1,110 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_rpc
+
+import (
+	"code.google.com/p/go-inject"
+	"sync"
+)
+
+/*
+	The context the call scope is entered with while a call is served. It is allocated for each
+	call, as the pointers arguments are decoded into may be shared by calls: arguments of zero size,
+	like struct{}, are all decoded into the same pointer.
+*/
+type servedCall struct {
+	// The pointer the arguments were decoded into, which is the context passed to call-scoped providers.
+	args interface{}
+}
+
+/*
+	The calls being served, by the pointer their arguments were decoded into, in the order they
+	were read. Receivers look up call-scoped values with their arguments as the context.
+*/
+var servedCalls = struct {
+	sync.Mutex
+	byArgs map[interface{}][]*servedCall
+}{byArgs: make(map[interface{}][]*servedCall)}
+
+func (this *servedCall) serve() {
+	servedCalls.Lock()
+	defer servedCalls.Unlock()
+	servedCalls.byArgs[this.args] = append(servedCalls.byArgs[this.args], this)
+}
+
+func (this *servedCall) served() {
+	servedCalls.Lock()
+	defer servedCalls.Unlock()
+	calls := servedCalls.byArgs[this.args]
+	for i, call := range calls {
+		if call == this {
+			calls = append(calls[:i:i], calls[i+1:]...)
+			break
+		}
+	}
+	if len(calls) == 0 {
+		delete(servedCalls.byArgs, this.args)
+	} else {
+		servedCalls.byArgs[this.args] = calls
+	}
+}
+
+/*
+	Returns the context the call scope holds the values of the call with the arguments in, or the
+	context itself if it is not the arguments of a call being served. Calls whose arguments share a
+	pointer cannot be told apart, so the earliest of them is used; give methods that look up
+	call-scoped values arguments that are not of zero size.
+*/
+func servedContext(context inject.Context) inject.Context {
+	servedCalls.Lock()
+	defer servedCalls.Unlock()
+	if calls, ok := servedCalls.byArgs[context]; ok {
+		return calls[0]
+	}
+	return context
+}
+
+/*
+	Wraps the call scope so that values are looked up with the arguments of the call being served
+	as the context, and are provided with the arguments as the context.
+*/
+type servedCallScope struct {
+	scope inject.SimpleScope
+}
+
+func (this servedCallScope) Scope(key inject.Key, provider inject.Provider) inject.Provider {
+	scoped := this.scope.Scope(key, func(context inject.Context, container inject.Container) interface{} {
+		return provider(context.(*servedCall).args, container)
+	})
+	return func(context inject.Context, container inject.Container) interface{} {
+		return scoped(servedContext(context), container)
+	}
+}
+
+func (this servedCallScope) Cached() []inject.CachedValues {
+	inspectable, ok := this.scope.(inject.InspectableScope)
+	if !ok {
+		return nil
+	}
+	cached := inspectable.Cached()
+	for i := range cached {
+		if served, ok := cached[i].Context.(*servedCall); ok {
+			cached[i].Context = served.args
+		}
+	}
+	return cached
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_rpc
+
+import (
+	"bufio"
+	"encoding/gob"
+	"io"
+	"net/rpc"
+	"sync"
+)
+
+// The gob codec used by rpc.Server.ServeConn, which net/rpc does not export.
+type gobServerCodec struct {
+	rwc    io.ReadWriteCloser
+	dec    *gob.Decoder
+	enc    *gob.Encoder
+	encBuf *bufio.Writer
+	closed bool
+}
+
+func newGobServerCodec(conn io.ReadWriteCloser) rpc.ServerCodec {
+	buf := bufio.NewWriter(conn)
+	return &gobServerCodec{rwc: conn, dec: gob.NewDecoder(conn), enc: gob.NewEncoder(buf), encBuf: buf}
+}
+
+func (this *gobServerCodec) ReadRequestHeader(request *rpc.Request) error {
+	return this.dec.Decode(request)
+}
+
+func (this *gobServerCodec) ReadRequestBody(body interface{}) error {
+	return this.dec.Decode(body)
+}
+
+func (this *gobServerCodec) WriteResponse(response *rpc.Response, body interface{}) error {
+	if err := this.enc.Encode(response); err != nil {
+		if this.encBuf.Flush() == nil {
+			// The response could not be encoded, so the connection can no longer be used.
+			this.Close()
+		}
+		return err
+	}
+	if err := this.enc.Encode(body); err != nil {
+		if this.encBuf.Flush() == nil {
+			this.Close()
+		}
+		return err
+	}
+	return this.encBuf.Flush()
+}
+
+func (this *gobServerCodec) Close() error {
+	if this.closed {
+		return nil
+	}
+	this.closed = true
+	return this.rwc.Close()
+}
+
+/*
+	Wraps a codec to serve each call in the call scope. The scope is entered with a servedCall for
+	each call when its arguments are read, and exited when its response is written. Receivers look
+	up call-scoped values with the pointer the arguments were decoded into, which rpc.Server passes
+	to the method if its arguments are a pointer type. See servedContext.
+*/
+type scopingCodec struct {
+	codec rpc.ServerCodec
+
+	// The header of the call being read. rpc.Server reads each header and body in turn.
+	serviceMethod string
+	seq           uint64
+	call          *servedCall
+
+	lock sync.Mutex
+
+	// The context of each call being served, by sequence number.
+	calls map[uint64]*servedCall
+}
+
+func newScopingCodec(codec rpc.ServerCodec) *scopingCodec {
+	return &scopingCodec{codec: codec, calls: make(map[uint64]*servedCall)}
+}
+
+func (this *scopingCodec) ReadRequestHeader(request *rpc.Request) error {
+	err := this.codec.ReadRequestHeader(request)
+	this.serviceMethod, this.seq, this.call = request.ServiceMethod, request.Seq, &servedCall{}
+	return err
+}
+
+func (this *scopingCodec) ReadRequestBody(body interface{}) error {
+	if err := this.codec.ReadRequestBody(body); err != nil || body == nil {
+		return err
+	}
+	call := this.call
+	call.args = body
+	callScope.Enter(call)
+	callScope.Seed(call, ServiceMethod{}, this.serviceMethod)
+	call.serve()
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.calls[this.seq] = call
+	return nil
+}
+
+// Exits the scope of the call, once it is no longer being served.
+func exit(call *servedCall) {
+	call.served()
+	callScope.Exit(call)
+}
+
+// Exits the scope of the call with the sequence number, if it was entered.
+func (this *scopingCodec) exit(seq uint64) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if call, exists := this.calls[seq]; exists {
+		delete(this.calls, seq)
+		exit(call)
+	}
+}
+
+func (this *scopingCodec) WriteResponse(response *rpc.Response, body interface{}) error {
+	this.exit(response.Seq)
+	return this.codec.WriteResponse(response, body)
+}
+
+func (this *scopingCodec) Close() error {
+	this.lock.Lock()
+	for seq, call := range this.calls {
+		delete(this.calls, seq)
+		exit(call)
+	}
+	this.lock.Unlock()
+	return this.codec.Close()
+}
@@ -0,0 +1,186 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+/*
+	Serves net/rpc services whose receivers are bound in an injector. Each call runs in its own
+	call scope, so receivers can look up CallScoped bindings like handlers in inject_http look up
+	RequestScoped bindings.
+*/
+package inject_rpc
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/multi"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"reflect"
+	"sync"
+)
+
+// Value for the rpc_port flag (default: 1234)
+var rpcPort *int = flag.Int("rpc_port", 1234, "port on which to start the rpc listener")
+
+// Container key for the *rpc.Server itself.
+type Server struct{}
+
+// Container key for the map of receivers, by service name.
+type Receivers struct{}
+
+// Container key for the TCP port for the server.
+type Port struct{}
+
+// Container key for the net.Listener the server accepts connections on.
+type Listener struct{}
+
+// Container key for the function creating the rpc.ServerCodec of each connection.
+type Codec struct{}
+
+/*
+	Scope tag for the caching in the context of an RPC call. Receivers look up call-scoped values with
+	the pointer to their arguments as the context, so methods that use them take pointer arguments.
+*/
+type CallScoped struct{}
+
+// Call-scoped container key for the "Service.Method" name of the call being served.
+type ServiceMethod struct{}
+
+var callScope = inject.CreateSimpleScopeWithName("RPC Call").(inject.SeedableScope)
+
+func init() {
+	// Report the module that bound a receiver, rather than this package, on duplicate names.
+	inject_multi.SkipSources(reflect.TypeOf(Server{}).PkgPath())
+}
+
+// Returns the map of receivers.
+func receivers(injector inject.Injector) inject_multi.MapOf[string, interface{}] {
+	return inject_multi.EnsureMapOfBound[string, interface{}](injector, Receivers{})
+}
+
+// Returns the optional binding of the listener, which defaults to a TCP listener on Port.
+func boundListener(injector inject.Injector) inject_multi.OptionalOf[net.Listener] {
+	return inject_multi.EnsureOptionalOfBound[net.Listener](injector, Listener{})
+}
+
+// Returns the optional binding of the codec, which defaults to gob.
+func boundCodec(injector inject.Injector) inject_multi.OptionalOf[func(io.ReadWriteCloser) rpc.ServerCodec] {
+	return inject_multi.EnsureOptionalOfBound[func(io.ReadWriteCloser) rpc.ServerCodec](injector, Codec{})
+}
+
+func providesRpcServer(_ inject.Context, container inject.Container) interface{} {
+	log.Printf("Creating RPC server")
+	server := rpc.NewServer()
+	all := container.GetTaggedInstance(nil, Receivers{}, inject_multi.Values{}).(map[string]interface{})
+	for name, receiver := range all {
+		if err := server.RegisterName(name, receiver); err != nil {
+			panic(fmt.Sprintf("Unable to register the receiver for %s: %v", name, err))
+		}
+	}
+	return server
+}
+
+func providesListener(_ inject.Context, container inject.Container) net.Listener {
+	port := container.GetInstance(nil, Port{}).(int)
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		panic(fmt.Sprintf("Unable to listen on port %d: %v", port, err))
+	}
+	return listener
+}
+
+// Wraps a provider so that its value is created once per binding, like the server in inject_http.
+func managed(provider inject.Provider) inject.Provider {
+	var lock sync.Mutex
+	var value interface{}
+	return func(context inject.Context, container inject.Container) interface{} {
+		lock.Lock()
+		defer lock.Unlock()
+		if value == nil {
+			value = provider(context, container)
+		}
+		return value
+	}
+}
+
+// Binds the following:
+//   inject_rpc.Port - the value of the rpc_port flag
+func ConfigureFlags(injector inject.Injector) {
+	injector.Bind(Port{}, func(_ inject.Context, _ inject.Container) interface{} { return *rpcPort })
+}
+
+// Binds the following:
+//   CallScoped scope
+//   inject_rpc.ServiceMethod - the "Service.Method" name of the call, seeded for every call
+func ConfigureScopes(injector inject.Injector) {
+	injector.BindScope(servedCallScope{callScope}, CallScoped{})
+	injector.BindInScope(ServiceMethod{}, func(_ inject.Context, _ inject.Container) interface{} {
+		panic("inject_rpc.ServiceMethod is only available while inject_rpc is serving a call.")
+	}, CallScoped{})
+}
+
+// Binds the following:
+//   inject_rpc.Server{} - the *rpc.Server with every bound receiver registered
+//   inject_rpc.Listener{} - the net.Listener the server accepts connections on. This is the
+//     listener bound with BindListener, if any, or a TCP listener on Port.
+//   inject_rpc.Codec{} - the func(io.ReadWriteCloser) rpc.ServerCodec of each connection. This
+//     is the codec bound with BindCodec or BindJSONCodec, if any, or gob as used by net/rpc.
+// Requires these bindings:
+//   inject_rpc.Receivers - a map[string]interface{} of the receivers bound with BindReceiver
+//   inject_rpc.Port - the TCP port, if no listener is bound. 0 listens on an ephemeral port.
+func ConfigureInjector(injector inject.Injector) {
+	injector.Bind(Server{}, managed(providesRpcServer))
+	boundListener(injector).BindDefaultInScope(providesListener, inject.Singleton{})
+	boundCodec(injector).BindDefaultInstance(newGobServerCodec)
+	receivers(injector)
+}
+
+/*
+	Binds the provider of the receiver of the service with the name. The receiver's exported methods
+	are served as described in rpc.Server.Register. Binding two receivers with the same name panics,
+	naming both callers.
+*/
+func BindReceiver(injector inject.Injector, name string, provider func(inject.Context, inject.Container) interface{}) {
+	receivers(injector).Bind(name, provider)
+}
+
+// Binds the receiver of the service with the name. See BindReceiver.
+func BindReceiverInstance(injector inject.Injector, name string, receiver interface{}) {
+	receivers(injector).BindInstance(name, receiver)
+}
+
+// Binds the listener the server accepts connections on, in place of a TCP listener on Port.
+func BindListener(injector inject.Injector, listener net.Listener) {
+	boundListener(injector).BindInstance(listener)
+}
+
+// Binds the function creating the codec of each connection, in place of gob.
+func BindCodec(injector inject.Injector, codec func(io.ReadWriteCloser) rpc.ServerCodec) {
+	boundCodec(injector).BindInstance(codec)
+}
+
+// Binds the JSON-RPC codec of net/rpc/jsonrpc in place of gob.
+func BindJSONCodec(injector inject.Injector) {
+	BindCodec(injector, jsonrpc.NewServerCodec)
+}
+
+// Returns the address the server bound in the injector listens on. See inject_http.Addr.
+func Addr(injector inject.Injector) net.Addr {
+	return injector.CreateContainer().GetInstance(nil, Listener{}).(net.Listener).Addr()
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_rpc_test
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/rpc"
+	"context"
+	"fmt"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"sync"
+	"testing"
+	"time"
+)
+
+type Calls struct{}
+
+type Args struct {
+	Name string
+}
+
+type Greeter struct {
+	injector inject.Injector
+}
+
+// Replies with a greeting, the call's number and its service method, looking the number up twice.
+func (this *Greeter) Greet(args *Args, reply *string) error {
+	first := this.injector.CreateContainer().GetInstance(args, Calls{}).(int)
+	second := this.injector.CreateContainer().GetInstance(args, Calls{}).(int)
+	method := this.injector.CreateContainer().GetInstance(args, inject_rpc.ServiceMethod{}).(string)
+	*reply = fmt.Sprintf("Hello %s (%d, %d) from %s", args.Name, first, second, method)
+	return nil
+}
+
+type Echoed struct{}
+
+type Echo struct {
+	injector inject.Injector
+}
+
+// Replies with the name of the call, as provided in the call scope.
+func (this *Echo) Echo(args *Args, reply *string) error {
+	*reply = this.injector.CreateContainer().GetInstance(args, Echoed{}).(string)
+	return nil
+}
+
+type Empty struct{}
+
+type Pinger struct {
+	injector inject.Injector
+}
+
+// Replies with the service method of the call, while other calls are served.
+func (this *Pinger) Ping(args *Empty, reply *string) error {
+	time.Sleep(time.Millisecond)
+	*reply = this.injector.CreateContainer().GetInstance(args, inject_rpc.ServiceMethod{}).(string)
+	return nil
+}
+
+// Starts the server, returning its address and a function that stops it.
+func startServer(t *testing.T, configure func(inject.Injector)) (string, func()) {
+	injector := inject.CreateInjector()
+	inject_rpc.ConfigureScopes(injector)
+	inject_rpc.ConfigureInjector(injector)
+	calls := 0
+	injector.BindInScope(Calls{}, func(_ inject.Context, _ inject.Container) interface{} {
+		calls++
+		return calls
+	}, inject_rpc.CallScoped{})
+	inject_rpc.BindReceiver(injector, "Greeter", func(_ inject.Context, _ inject.Container) interface{} {
+		return &Greeter{injector}
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inject_rpc.BindListener(injector, listener)
+	configure(injector)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- inject_rpc.Run(ctx, injector)
+	}()
+	return listener.Addr().String(), func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Expected the server to stop cleanly, got %v", err)
+		}
+	}
+}
+
+func testCalls(t *testing.T, client *rpc.Client) {
+	defer client.Close()
+	for call := 1; call <= 2; call++ {
+		var reply string
+		if err := client.Call("Greeter.Greet", &Args{"gopher"}, &reply); err != nil {
+			t.Fatal(err)
+		}
+		expected := fmt.Sprintf("Hello gopher (%d, %d) from Greeter.Greet", call, call)
+		if reply != expected {
+			t.Errorf("Expected %q, got %q", expected, reply)
+		}
+	}
+}
+
+func TestCallScopeWithGob(t *testing.T) {
+	addr, stop := startServer(t, func(inject.Injector) {})
+	defer stop()
+	client, err := rpc.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCalls(t, client)
+}
+
+func TestCallScopeWithJSON(t *testing.T) {
+	addr, stop := startServer(t, inject_rpc.BindJSONCodec)
+	defer stop()
+	client, err := jsonrpc.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCalls(t, client)
+}
+
+func TestBindingReceiversWithTheSameNamePanics(t *testing.T) {
+	injector := inject.CreateInjector()
+	inject_rpc.BindReceiverInstance(injector, "Greeter", &Greeter{})
+	defer func() {
+		recover() // Expected
+	}()
+	inject_rpc.BindReceiverInstance(injector, "Greeter", &Greeter{})
+	t.Error("Expected a panic when binding a second Greeter")
+}
+
+func TestConcurrentCallsAreScopedSeparately(t *testing.T) {
+	addr, stop := startServer(t, func(injector inject.Injector) {
+		injector.BindInScope(Echoed{}, func(context inject.Context, _ inject.Container) interface{} {
+			return context.(*Args).Name
+		}, inject_rpc.CallScoped{})
+		inject_rpc.BindReceiver(injector, "Echo", func(_ inject.Context, _ inject.Container) interface{} {
+			return &Echo{injector}
+		})
+	})
+	defer stop()
+	client, err := rpc.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var wait sync.WaitGroup
+	for call := 0; call < 50; call++ {
+		wait.Add(1)
+		go func(name string) {
+			defer wait.Done()
+			var reply string
+			if err := client.Call("Echo.Echo", &Args{name}, &reply); err != nil {
+				t.Error(err)
+			} else if reply != name {
+				t.Errorf("Expected %q, got %q", name, reply)
+			}
+		}(fmt.Sprintf("call %d", call))
+	}
+	wait.Wait()
+}
+
+func TestConcurrentCallsWithZeroSizeArgs(t *testing.T) {
+	addr, stop := startServer(t, func(injector inject.Injector) {
+		inject_rpc.BindReceiver(injector, "Pinger", func(_ inject.Context, _ inject.Container) interface{} {
+			return &Pinger{injector}
+		})
+	})
+	defer stop()
+	client, err := rpc.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var wait sync.WaitGroup
+	for call := 0; call < 50; call++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			var reply string
+			if err := client.Call("Pinger.Ping", &Empty{}, &reply); err != nil {
+				t.Error(err)
+			} else if reply != "Pinger.Ping" {
+				t.Errorf("Expected Pinger.Ping, got %q", reply)
+			}
+		}()
+	}
+	wait.Wait()
+}
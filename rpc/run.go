@@ -0,0 +1,100 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_rpc
+
+import (
+	"code.google.com/p/go-inject"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/rpc"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+/*
+	Runs the server bound to inject_rpc.Server{} in the injector on the listener bound to
+	inject_rpc.Listener{}, with the codec bound to inject_rpc.Codec{}. Once the server has stopped,
+	as described in Serve, the injector's shutdown hooks are called. See inject.OnShutdown.
+*/
+func Run(ctx context.Context, injector inject.Injector) error {
+	container := injector.CreateContainer()
+	err := Serve(
+		ctx,
+		container.GetInstance(nil, Server{}).(*rpc.Server),
+		container.GetInstance(nil, Listener{}).(net.Listener),
+		container.GetInstance(nil, Codec{}).(func(io.ReadWriteCloser) rpc.ServerCodec),
+	)
+	return errors.Join(err, inject.Shutdown(injector))
+}
+
+/*
+	Serves RPC calls on the connections accepted by listener with server until ctx is cancelled or
+	the process receives SIGINT or SIGTERM. Each call is served in the call scope. The listener and
+	all open connections are then closed, exiting the scope of any calls in progress.
+
+	Returns nil once the server is stopped, or an error describing why connections could not be
+	accepted. No shutdown hooks are called; see inject.Shutdown.
+*/
+func Serve(ctx context.Context, server *rpc.Server, listener net.Listener, codec func(io.ReadWriteCloser) rpc.ServerCodec) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	var lock sync.Mutex
+	var serving sync.WaitGroup
+	conns := make(map[net.Conn]bool)
+	defer func() {
+		lock.Lock()
+		for conn := range conns {
+			conn.Close()
+		}
+		lock.Unlock()
+		serving.Wait()
+	}()
+
+	log.Printf("Serving RPC on %s", listener.Addr())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				log.Printf("Shutting down RPC server on %s", listener.Addr())
+				return nil
+			}
+			return fmt.Errorf("inject_rpc: unable to accept connections on %s: %w", listener.Addr(), err)
+		}
+		lock.Lock()
+		conns[conn] = true
+		lock.Unlock()
+		serving.Add(1)
+		go func() {
+			defer serving.Done()
+			server.ServeCodec(newScopingCodec(codec(conn)))
+			lock.Lock()
+			delete(conns, conn)
+			lock.Unlock()
+		}()
+	}
+}
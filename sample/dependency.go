@@ -14,6 +14,10 @@
  * limitations under the License.
  */
 
+// Run with go run; each sample is a separate program.
+
+//go:build ignore
+
 package main
 
 import (
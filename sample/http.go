@@ -14,11 +14,16 @@
  * limitations under the License.
  */
 
+// Run with go run; each sample is a separate program.
+
+//go:build ignore
+
 package main
 
 import (
 	"code.google.com/p/go-inject"
 	"code.google.com/p/go-inject/http"
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -83,13 +88,10 @@ func main() {
 	ConfigureFooInjector(injector)
 	ConfigureInjector(injector)
 
-	// Look up an object by creating a Container. The Container ensures there are no dependency
-	// loops configured in the Injector. Top-level code should create a new container for each
-	// object lookup. Provider functions will have a container passed to them, and they use that
-	// container for their lookups.
-	container := injector.CreateContainer()
-	httpServer := container.GetInstance(nil, inject_http.Server{}).(http.Server)
-
-	// Start the HTTP server.
-	log.Fatal(httpServer.ListenAndServe())
+	// Start the HTTP server. Run looks up the server by creating a Container, which ensures there
+	// are no dependency loops configured in the Injector. It serves until the process is
+	// interrupted, then waits for in-flight requests to finish.
+	if err := inject_http.Run(context.Background(), injector); err != nil {
+		log.Fatal(err)
+	}
 }
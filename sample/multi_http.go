@@ -14,11 +14,16 @@
  * limitations under the License.
  */
 
+// Run with go run; each sample is a separate program.
+
+//go:build ignore
+
 package main
 
 import (
 	"code.google.com/p/go-inject"
 	"code.google.com/p/go-inject/http"
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -36,11 +41,11 @@ func ConfigureCounter(injector inject.Injector) {
 	}, inject_http.RequestScoped{})
 }
 
-// Configure HTTP server path mappings and provider functions.
-func ConfigureInjector(injector inject.Injector) {
-
-	inject_http.BindHandlerFunc(
+// Configure HTTP server path mappings and provider functions for the server with the tag.
+func ConfigureInjector(injector inject.Injector, server inject.Tag) {
+	inject_http.BindServerHandlerFunc(
 		injector,
+		server,
 		"/",
 		func(w http.ResponseWriter, request *http.Request) {
 			w.Header().Add(
@@ -55,16 +60,6 @@ func ConfigureInjector(injector inject.Injector) {
 type OneServer struct{}
 type TwoServer struct{}
 
-// Configure a single HTTP server on a port and expose it using the tag.
-func ConfigureServer(injector inject.Injector, port int, tag inject.Tag) {
-	// Each HTTP server needs to have a port bound. The port is statically configured here, but
-	// it could be configured using a Provider that allocates an unused port.
-	injector.BindInstance(inject_http.Port{}, port)
-	inject_http.ConfigureInjector(injector)
-	ConfigureInjector(injector)
-	injector.ExposeAndTag(inject_http.Server{}, tag)
-}
-
 func main() {
 	// Initialize the flag(s)
 	flag.Parse()
@@ -83,30 +78,16 @@ func main() {
 		injector,
 	)
 
-	// Create a child injector for each server. Each child injector is isolated, so the HTTP module
-	// can be bound multiple times. Only the exposed bindings have the potential to collide. Note
-	// that if either server were bound in the parent injector, all the bindings would collide.
-	oneServerInjector := injector.CreateChildInjector()
-	twoServerInjector := injector.CreateChildInjector()
-
-	// Configure each server on its own port, exposing the server in the parent injector with its
-	// own tag.
-	ConfigureServer(oneServerInjector, 8080, OneServer{})
-	ConfigureServer(twoServerInjector, 8081, TwoServer{})
-
-	oneHttpServer := injector.CreateContainer().GetTaggedInstance(
-		nil,
-		inject_http.Server{},
-		OneServer{}).(http.Server)
-
-	// What would I do with go-routines? Two HTTP servers at the same time.
-	go func() {
-		log.Fatal(oneHttpServer.ListenAndServe())
-	}()
-
-	twoHttpServer := injector.CreateContainer().GetTaggedInstance(
-		nil,
-		inject_http.Server{},
-		TwoServer{}).(http.Server)
-	log.Fatal(twoHttpServer.ListenAndServe())
+	// Declare each server on its own port. Each server is identified by its tag, which is used to
+	// route handlers to it. The address is statically configured here, but port 0 would listen on
+	// an unused port.
+	inject_http.DeclareServer(injector, OneServer{}, inject_http.ServerConfig{Addr: ":8080"})
+	inject_http.DeclareServer(injector, TwoServer{}, inject_http.ServerConfig{Addr: ":8081"})
+	ConfigureInjector(injector, OneServer{})
+	ConfigureInjector(injector, TwoServer{})
+
+	// Two HTTP servers at the same time. Both stop together when the process is interrupted.
+	if err := inject_http.RunServers(context.Background(), injector); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,60 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject
+
+import (
+	"errors"
+	"sync"
+)
+
+// The functions to call when the servers of an injector shut down.
+type shutdownHooks struct {
+	lock  sync.Mutex
+	hooks []func() error
+}
+
+/*
+	Adds a function to call when the servers of the injector shut down, like closing a database
+	that its bindings opened. The hooks apply to the injector along with all of its ancestors and
+	descendants. See Shutdown().
+*/
+func OnShutdown(hooked Injector, hook func() error) {
+	shutdown := hooked.(*injector).shutdown
+	shutdown.lock.Lock()
+	defer shutdown.lock.Unlock()
+	shutdown.hooks = append(shutdown.hooks, hook)
+}
+
+/*
+	Calls the shutdown hooks of the injector, in the reverse of the order they were added, and
+	returns their errors joined. The Run functions of inject_http and inject_rpc call this once their
+	servers have stopped; servers run otherwise must call it themselves. Hooks are called each time
+	the injector is shut down, so they should do nothing once they have run, as when the injector's
+	servers are run again.
+*/
+func Shutdown(stopped Injector) error {
+	shutdown := stopped.(*injector).shutdown
+	shutdown.lock.Lock()
+	hooks := append([]func() error(nil), shutdown.hooks...)
+	shutdown.lock.Unlock()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		errs = append(errs, hooks[i]())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+/*
+	Binds a *sql.DB opened from the bound driver and data source name, and runs functions in a
+	transaction scope where the *sql.Tx is a scoped binding.
+
+	The database is closed when the injector shuts down, so inject_http.Run and inject_rpc.Run close
+	it once their servers have stopped. Servers run otherwise must call inject.Shutdown, or Close,
+	once the injector is no longer used.
+*/
+package inject_sql
+
+import (
+	"code.google.com/p/go-inject"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Value for the sql_driver flag
+var sqlDriver *string = flag.String("sql_driver", "", "name of the database/sql driver to open the database with")
+
+// Value for the sql_dsn flag
+var sqlDSN *string = flag.String("sql_dsn", "", "data source name of the database, as understood by the driver")
+
+// Container key for the *sql.DB.
+type DB struct{}
+
+// Container key for the name of the database/sql driver, a string.
+type Driver struct{}
+
+// Container key for the data source name of the database, a string.
+type DSN struct{}
+
+// Scope tag for the caching in the context of a transaction run with InTransaction.
+type TransactionScoped struct{}
+
+// Transaction-scoped container key for the *sql.Tx of the transaction.
+type Tx struct{}
+
+// Container key for the database managed by this package.
+type database struct{}
+
+var transactionScope = inject.CreateSimpleScopeWithName("SQL Transaction").(inject.SeedableScope)
+
+// The *sql.DB of an injector, opened when it is first looked up.
+type managedDB struct {
+	lock sync.Mutex
+	db   *sql.DB
+}
+
+func (this *managedDB) open(container inject.Container) *sql.DB {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.db == nil {
+		driver := container.GetInstance(nil, Driver{}).(string)
+		dsn := container.GetInstance(nil, DSN{}).(string)
+		log.Printf("Opening %s database", driver)
+		db, err := sql.Open(driver, dsn)
+		if err != nil {
+			panic(fmt.Sprintf("Unable to open %s database: %v", driver, err))
+		}
+		this.db = db
+	}
+	return this.db
+}
+
+func (this *managedDB) close() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.db == nil {
+		return nil
+	}
+	log.Printf("Closing database")
+	err := this.db.Close()
+	this.db = nil
+	return err
+}
+
+// Binds the following:
+//   inject_sql.Driver - the value of the sql_driver flag
+//   inject_sql.DSN - the value of the sql_dsn flag
+func ConfigureFlags(injector inject.Injector) {
+	injector.Bind(Driver{}, func(_ inject.Context, _ inject.Container) interface{} { return *sqlDriver })
+	injector.Bind(DSN{}, func(_ inject.Context, _ inject.Container) interface{} { return *sqlDSN })
+}
+
+// Binds the following:
+//   TransactionScoped scope
+//   inject_sql.Tx - the *sql.Tx of the transaction, seeded by InTransaction
+func ConfigureScopes(injector inject.Injector) {
+	injector.BindScope(transactionScope, TransactionScoped{})
+	injector.BindInScope(Tx{}, func(_ inject.Context, _ inject.Container) interface{} {
+		panic("inject_sql.Tx is only available inside InTransaction.")
+	}, TransactionScoped{})
+}
+
+// Binds the following:
+//   inject_sql.DB{} - the *sql.DB, opened when it is first looked up. It is closed by the
+//     injector's shutdown hooks (see inject.OnShutdown), or by Close.
+// Requires these bindings:
+//   inject_sql.Driver - the name of the driver
+//   inject_sql.DSN - the data source name
+func ConfigureInjector(injector inject.Injector) {
+	managed := &managedDB{}
+	injector.BindInstance(database{}, managed)
+	inject.OnShutdown(injector, managed.close)
+	injector.Bind(DB{}, func(_ inject.Context, container inject.Container) interface{} {
+		return managed.open(container)
+	})
+}
+
+/*
+	Closes the *sql.DB bound in the injector, if it has been opened. The injector's shutdown hooks
+	close it as well, so this is only needed when the injector is not shut down with inject.Shutdown,
+	as the Run functions of inject_http and inject_rpc do.
+*/
+func Close(injector inject.Injector) error {
+	return injector.CreateContainer().GetInstance(nil, database{}).(*managedDB).close()
+}
@@ -0,0 +1,255 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_sql_test
+
+import (
+	"code.google.com/p/go-inject"
+	"code.google.com/p/go-inject/http"
+	"code.google.com/p/go-inject/sql"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+)
+
+// An in-memory database holding the values inserted by committed statements.
+type fakeDatabase struct {
+	lock      sync.Mutex
+	values    []string
+	rollbacks int
+	closed    bool
+}
+
+var fakeDatabases = struct {
+	sync.Mutex
+	byName map[string]*fakeDatabase
+}{byName: make(map[string]*fakeDatabase)}
+
+// Replaces the fake database with the name with an empty one, so repeated tests start afresh.
+func newFakeDatabase(name string) *fakeDatabase {
+	fakeDatabases.Lock()
+	defer fakeDatabases.Unlock()
+	fakeDatabases.byName[name] = &fakeDatabase{}
+	return fakeDatabases.byName[name]
+}
+
+// Returns the fake database with the name, which is the data source name.
+func fakeDatabaseNamed(name string) *fakeDatabase {
+	fakeDatabases.Lock()
+	defer fakeDatabases.Unlock()
+	if _, exists := fakeDatabases.byName[name]; !exists {
+		fakeDatabases.byName[name] = &fakeDatabase{}
+	}
+	return fakeDatabases.byName[name]
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{database: fakeDatabaseNamed(name)}, nil
+}
+
+// A connection that supports "INSERT" statements with one argument, inserting it into the database.
+type fakeConn struct {
+	database *fakeDatabase
+	inTx     bool
+	pending  []string
+}
+
+func (this *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	if query != "INSERT" {
+		return nil, fmt.Errorf("unsupported query %q", query)
+	}
+	return fakeStmt{this}, nil
+}
+
+func (this *fakeConn) Close() error {
+	this.database.lock.Lock()
+	defer this.database.lock.Unlock()
+	this.database.closed = true
+	return nil
+}
+
+func (this *fakeConn) Begin() (driver.Tx, error) {
+	this.inTx = true
+	return fakeTx{this}, nil
+}
+
+type fakeStmt struct {
+	conn *fakeConn
+}
+
+func (this fakeStmt) Close() error  { return nil }
+func (this fakeStmt) NumInput() int { return 1 }
+
+func (this fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	this.conn.pending = append(this.conn.pending, fmt.Sprint(args[0]))
+	if !this.conn.inTx {
+		fakeTx{this.conn}.Commit()
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (this fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("queries are not supported")
+}
+
+type fakeTx struct {
+	conn *fakeConn
+}
+
+func (this fakeTx) Commit() error {
+	this.conn.database.lock.Lock()
+	defer this.conn.database.lock.Unlock()
+	this.conn.database.values = append(this.conn.database.values, this.conn.pending...)
+	this.conn.pending, this.conn.inTx = nil, false
+	return nil
+}
+
+func (this fakeTx) Rollback() error {
+	this.conn.database.lock.Lock()
+	defer this.conn.database.lock.Unlock()
+	this.conn.database.rollbacks++
+	this.conn.pending, this.conn.inTx = nil, false
+	return nil
+}
+
+func init() {
+	sql.Register("inject_sql_fake", fakeDriver{})
+}
+
+type Inserter struct{}
+
+// Returns an injector for a new, empty fake database with the name, and the database.
+func fakeInjector(name string) (inject.Injector, *fakeDatabase) {
+	database := newFakeDatabase(name)
+	injector := inject.CreateInjector()
+	inject_sql.ConfigureScopes(injector)
+	inject_sql.ConfigureInjector(injector)
+	injector.BindInstance(inject_sql.Driver{}, "inject_sql_fake")
+	injector.BindInstance(inject_sql.DSN{}, name)
+	// A transaction-scoped value depending on the transaction.
+	injector.BindInScope(Inserter{}, func(context inject.Context, container inject.Container) interface{} {
+		tx := container.GetInstance(context, inject_sql.Tx{}).(*sql.Tx)
+		return func(value string) error {
+			_, err := tx.Exec("INSERT", value)
+			return err
+		}
+	}, inject_sql.TransactionScoped{})
+	return injector, database
+}
+
+func insert(injector inject.Injector, context inject.Context, value string) error {
+	return injector.CreateContainer().GetInstance(context, Inserter{}).(func(string) error)(value)
+}
+
+func TestTransactionCommits(t *testing.T) {
+	injector, database := fakeInjector(t.Name())
+	err := inject_sql.InTransaction(context.Background(), injector, func(context inject.Context) error {
+		if err := insert(injector, context, "first"); err != nil {
+			return err
+		}
+		return insert(injector, context, "second")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(database.values) != "[first second]" {
+		t.Errorf("Expected both values to be committed, got %v", database.values)
+	}
+}
+
+func TestTransactionRollsBackOnError(t *testing.T) {
+	injector, database := fakeInjector(t.Name())
+	failure := errors.New("failed")
+	err := inject_sql.InTransaction(context.Background(), injector, func(context inject.Context) error {
+		insert(injector, context, "first")
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("Expected the error from the function, got %v", err)
+	}
+	if len(database.values) != 0 || database.rollbacks != 1 {
+		t.Errorf("Expected the transaction to be rolled back, got %v after %d rollbacks", database.values, database.rollbacks)
+	}
+}
+
+func TestTransactionRollsBackOnPanic(t *testing.T) {
+	injector, database := fakeInjector(t.Name())
+	var scope inject.Context
+	func() {
+		defer func() {
+			recover() // Expected
+		}()
+		inject_sql.InTransaction(context.Background(), injector, func(context inject.Context) error {
+			scope = context
+			insert(injector, context, "first")
+			panic("failed")
+		})
+	}()
+	if len(database.values) != 0 || database.rollbacks != 1 {
+		t.Errorf("Expected the transaction to be rolled back, got %v after %d rollbacks", database.values, database.rollbacks)
+	}
+
+	defer func() {
+		recover() // Expected
+	}()
+	insert(injector, scope, "second")
+	t.Error("Expected the transaction scope to be exited")
+}
+
+func TestCloseClosesDatabase(t *testing.T) {
+	injector, database := fakeInjector(t.Name())
+	inject_sql.InTransaction(context.Background(), injector, func(context inject.Context) error {
+		return insert(injector, context, "first")
+	})
+	if err := inject_sql.Close(injector); err != nil {
+		t.Fatal(err)
+	}
+	if !database.closed {
+		t.Error("Expected the connection to the database to be closed")
+	}
+}
+
+func TestRunClosesDatabase(t *testing.T) {
+	injector, database := fakeInjector(t.Name())
+	inject_http.ConfigureScopes(injector)
+	inject_http.ConfigureInjector(injector)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inject_http.BindListener(injector, listener)
+	inject_sql.InTransaction(context.Background(), injector, func(context inject.Context) error {
+		return insert(injector, context, "first")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := inject_http.Run(ctx, injector); err != nil {
+		t.Fatal(err)
+	}
+	database.lock.Lock()
+	defer database.lock.Unlock()
+	if !database.closed {
+		t.Error("Expected the database to be closed when Run returns")
+	}
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright 2013 Google Inc. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inject_sql
+
+import (
+	"code.google.com/p/go-inject"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// The context of a transaction run with InTransaction.
+type transaction struct {
+	tx *sql.Tx
+}
+
+/*
+	Begins a transaction on the *sql.DB bound in the injector and calls fn inside the transaction
+	scope, with the context to look up TransactionScoped bindings like Tx with. If fn returns nil,
+	the transaction is committed. If fn returns an error or panics, the transaction is rolled back
+	and the error is returned or the panic continues. The scope is exited either way.
+
+	Returns the error from fn, or from beginning or committing the transaction.
+*/
+func InTransaction(ctx context.Context, injector inject.Injector, fn func(context inject.Context) error) (err error) {
+	db := injector.CreateContainer().GetInstance(nil, DB{}).(*sql.DB)
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("inject_sql: unable to begin a transaction: %w", err)
+	}
+
+	scope := &transaction{tx}
+	transactionScope.Enter(scope)
+	defer transactionScope.Exit(scope)
+	transactionScope.Seed(scope, Tx{}, tx)
+
+	committed := false
+	defer func() {
+		if !committed {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && err != nil {
+				err = errors.Join(err, fmt.Errorf("inject_sql: unable to roll back the transaction: %w", rollbackErr))
+			}
+		}
+	}()
+
+	if err := fn(scope); err != nil {
+		return err
+	}
+	committed = true
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("inject_sql: unable to commit the transaction: %w", err)
+	}
+	return nil
+}